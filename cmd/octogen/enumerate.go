@@ -0,0 +1,126 @@
+/*
+ * Copyright 2020 zpxio (Jeff Sharpe)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/zpxio/octogen/generator"
+	"os"
+	"strings"
+)
+
+// tsvEscaper escapes the characters which would break a line of tab-separated output.
+var tsvEscaper = strings.NewReplacer("\\", "\\\\", "\t", "\\t", "\n", "\\n", "\r", "\\r")
+
+// enumeratedResult is the JSON form of a single enumerated result.
+type enumeratedResult struct {
+	Text        string   `json:"text"`
+	Probability float64  `json:"probability"`
+	IDs         []string `json:"ids,omitempty"`
+}
+
+// runEnumerate implements the 'enumerate' command, printing every possible result of an instruction
+// along with its probability.
+func runEnumerate(args []string) error {
+	fs := flag.NewFlagSet("enumerate", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: octogen enumerate -i inventory.yml [options] [instruction]\n\n")
+		fmt.Fprintf(fs.Output(), "The instruction is read from the argument, the -f file, or stdin.\n")
+		fmt.Fprintf(fs.Output(), "TSV output has probability, text and ID columns; JSON output has one object per line.\n\n")
+		fs.PrintDefaults()
+	}
+
+	var inventories listFlag
+	vars := varFlag{}
+	fs.Var(&inventories, "i", "inventory `file`, directory or glob to load (repeatable)")
+	strict := fs.Bool("strict", false, "fail if any inventory entry is invalid")
+	format := fs.String("format", "auto", "inventory `format`: auto, yaml, json, toml or csv")
+	file := fs.String("f", "", "read the instruction from `file` ('-' for stdin)")
+	fs.Var(vars, "var", "initial State variable as `name=value` (repeatable)")
+	missing := fs.String("missing", "fail", "unmatched selector `policy`: fail, leave, empty, or fallback:Category")
+	limit := fs.Int("limit", 10000, fmt.Sprintf("maximum number of results to print (at most %d)", generator.ExploreLimit))
+	output := fs.String("output", "tsv", "output `format`: tsv or json")
+	verbose := fs.Bool("v", false, "enable verbose logging")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	setVerbose(*verbose)
+
+	if *limit < 1 {
+		return errors.New("limit (-limit) must be at least 1")
+	}
+	if *limit > generator.ExploreLimit {
+		*limit = generator.ExploreLimit
+	}
+	if *output != "tsv" && *output != "json" {
+		return errors.Errorf("unknown output format: %q", *output)
+	}
+
+	policy, err := generator.ParseMissingPolicy(*missing)
+	if err != nil {
+		return err
+	}
+
+	inv, err := loadInventory(inventories, *strict, *format)
+	if err != nil {
+		return err
+	}
+
+	instruction, err := readInstruction(fs.Args(), *file)
+	if err != nil {
+		return err
+	}
+
+	t, err := generator.Compile(instruction)
+	if err != nil {
+		return err
+	}
+
+	state := generator.CreateState()
+	state.SetVars(vars)
+
+	out := bufio.NewWriter(os.Stdout)
+	defer out.Flush()
+	enc := json.NewEncoder(out)
+	enc.SetEscapeHTML(false)
+
+	printed := 0
+	complete, err := generator.Enumerate(t, inv, state, policy, *limit, func(e generator.Enumeration) error {
+		printed++
+		if *output == "json" {
+			return enc.Encode(enumeratedResult{Text: e.Text, Probability: e.Probability, IDs: e.IDs})
+		}
+
+		_, err := fmt.Fprintf(out, "%g\t%s\t%s\n", e.Probability, tsvEscaper.Replace(e.Text), strings.Join(e.IDs, ","))
+		return err
+	})
+	if err != nil {
+		return errors.Wrap(err, "enumerating instruction")
+	}
+	if !complete && *limit < generator.ExploreLimit {
+		fmt.Fprintf(os.Stderr, "Stopped after %d results; use -limit to see more\n", printed)
+	} else if !complete {
+		fmt.Fprintf(os.Stderr, "Stopped after %d results, the most which can be enumerated\n", printed)
+	}
+
+	return nil
+}
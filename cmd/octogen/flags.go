@@ -0,0 +1,185 @@
+/*
+ * Copyright 2020 zpxio (Jeff Sharpe)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/apex/log"
+	"github.com/pkg/errors"
+	"github.com/zpxio/octogen/generator"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// listFlag collects every occurrence of a repeatable string flag.
+type listFlag []string
+
+func (l *listFlag) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *listFlag) Set(v string) error {
+	*l = append(*l, v)
+	return nil
+}
+
+// varFlag collects repeatable name=value pairs used to seed State variables.
+type varFlag map[string]string
+
+func (v varFlag) String() string {
+	parts := make([]string, 0, len(v))
+	for name, val := range v {
+		parts = append(parts, name+"="+val)
+	}
+	return strings.Join(parts, ",")
+}
+
+func (v varFlag) Set(s string) error {
+	eq := strings.Index(s, "=")
+	if eq < 1 {
+		return fmt.Errorf("variable must be in the form name=value: %q", s)
+	}
+
+	v[s[:eq]] = s[eq+1:]
+	return nil
+}
+
+// seedFlag holds a random seed, recording whether one was given so that zero can be chosen.
+type seedFlag struct {
+	value uint64
+	set   bool
+}
+
+func (f *seedFlag) String() string {
+	if !f.set {
+		return ""
+	}
+	return strconv.FormatUint(f.value, 10)
+}
+
+func (f *seedFlag) Set(s string) error {
+	value, err := strconv.ParseUint(s, 0, 64)
+	if err != nil {
+		return fmt.Errorf("seed must be a non-negative integer: %q", s)
+	}
+
+	f.value = value
+	f.set = true
+	return nil
+}
+
+// setVerbose raises the log level when verbose output was requested.
+func setVerbose(verbose bool) {
+	if verbose {
+		log.SetLevel(log.DebugLevel)
+	}
+}
+
+// loadInventory builds a single Inventory from all of the supplied files. Problems with individual
+// entries are printed to stderr, and fail the load in strict mode.
+func loadInventory(paths []string, strict bool, format string) (*generator.Inventory, error) {
+	if len(paths) == 0 {
+		return nil, errors.New("at least one inventory file or directory is required (-i)")
+	}
+
+	f, err := generator.ParseFormat(format)
+	if err != nil {
+		return nil, err
+	}
+
+	inv := generator.CreateInventory()
+	report, err := inv.LoadPathsWithReport(paths, generator.LoadOptions{Strict: strict, Format: f})
+	if report != nil {
+		for _, issue := range report.Issues {
+			fmt.Fprintln(os.Stderr, issue)
+		}
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "loading inventory")
+	}
+
+	return inv, nil
+}
+
+// readInstruction resolves the instruction text from a positional argument, a file, or stdin,
+// in that order of preference.
+func readInstruction(args []string, file string) (string, error) {
+	if len(args) > 1 {
+		return "", errors.New("only one instruction may be supplied")
+	}
+
+	if len(args) == 1 {
+		if file != "" {
+			return "", errors.New("an instruction argument and -f cannot be used together")
+		}
+		return args[0], nil
+	}
+
+	var data []byte
+	var err error
+	if file != "" && file != "-" {
+		data, err = ioutil.ReadFile(file)
+	} else {
+		data, err = ioutil.ReadAll(os.Stdin)
+	}
+	if err != nil {
+		return "", errors.Wrap(err, "reading instruction")
+	}
+
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// readLines reads the non-empty lines of the file at path.
+func readLines(path string) ([]string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var lines []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimRight(line, "\r")
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+
+	return lines, nil
+}
+
+// readJSON decodes the JSON file at path into v.
+func readJSON(path string, v interface{}) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, v)
+}
+
+// writeJSON encodes v as indented JSON into the file at path.
+func writeJSON(path string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, append(data, '\n'), 0644)
+}
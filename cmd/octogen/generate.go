@@ -0,0 +1,181 @@
+/*
+ * Copyright 2020 zpxio (Jeff Sharpe)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/zpxio/octogen/generator"
+	"github.com/zpxio/octogen/rng"
+	"os"
+	"strings"
+	"time"
+)
+
+// runGenerate implements the 'generate' command, rendering an instruction a number of times
+// against the supplied inventories and printing one result per line.
+func runGenerate(args []string) error {
+	fs := flag.NewFlagSet("generate", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: octogen generate -i inventory.yml [options] [instruction]\n\n")
+		fmt.Fprintf(fs.Output(), "The instruction is read from the argument, the -f file, or stdin.\n\n")
+		fs.PrintDefaults()
+	}
+
+	var inventories listFlag
+	vars := varFlag{}
+	fs.Var(&inventories, "i", "inventory `file`, directory or glob to load (repeatable)")
+	strict := fs.Bool("strict", false, "fail if any inventory entry is invalid")
+	format := fs.String("format", "auto", "inventory `format`: auto, yaml, json, toml or csv")
+	file := fs.String("f", "", "read the instruction from `file` ('-' for stdin)")
+	count := fs.Int("n", 1, "number of results to generate")
+	var seed seedFlag
+	fs.Var(&seed, "seed", "random `seed` for repeatable output (default time-based, printed to stderr)")
+	fs.Var(vars, "var", "initial State variable as `name=value` (repeatable)")
+	missing := fs.String("missing", "fail", "unmatched selector `policy`: fail, leave, empty, or fallback:Category")
+	secure := fs.Bool("secure", false, "use a cryptographically secure random source (ignores -seed)")
+	record := fs.String("record", "", "write the random values drawn for each result to a JSON `file`")
+	replay := fs.String("replay", "", "reproduce the results recorded in a JSON `file` by -record")
+	ids := fs.Bool("ids", false, "print the IDs of the tokens picked for each result to stderr")
+	entropy := fs.Bool("entropy", false, "print an entropy estimate for the instruction to stderr")
+	unique := fs.Bool("unique", false, "generate -n distinct results")
+	attempts := fs.Int("attempts", 0, "maximum `runs` for -unique (default 10 per result)")
+	exclude := fs.String("exclude", "", "with -unique, never produce the results listed one per line in `file`")
+	verbose := fs.Bool("v", false, "enable verbose logging")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	setVerbose(*verbose)
+
+	if *count < 1 {
+		return errors.New("count (-n) must be at least 1")
+	}
+	if *unique && (*record != "" || *replay != "" || *ids) {
+		return errors.New("-unique cannot be combined with -record, -replay or -ids")
+	}
+	if *exclude != "" && !*unique {
+		return errors.New("-exclude requires -unique")
+	}
+	if *replay != "" && *secure {
+		return errors.New("-replay cannot be combined with -secure")
+	}
+
+	policy, err := generator.ParseMissingPolicy(*missing)
+	if err != nil {
+		return err
+	}
+
+	inv, err := loadInventory(inventories, *strict, *format)
+	if err != nil {
+		return err
+	}
+
+	instruction, err := readInstruction(fs.Args(), *file)
+	if err != nil {
+		return err
+	}
+
+	g, err := generator.CompileGenerator(instruction, inv)
+	if err != nil {
+		return err
+	}
+	g.UseMissingPolicy(policy)
+	if *secure {
+		g.RequireSecure()
+	} else if *replay == "" {
+		if !seed.set {
+			seed.value = uint64(time.Now().UnixNano())
+		}
+		fmt.Fprintf(os.Stderr, "Seed: %d\n", seed.value)
+		g.UseRandomSource(rng.UseSeeded(seed.value))
+	}
+
+	if *entropy {
+		state := generator.CreateState()
+		state.SetVars(vars)
+
+		e, err := g.Entropy(state)
+		if err != nil {
+			return errors.Wrap(err, "estimating entropy")
+		}
+		fmt.Fprintf(os.Stderr, "Entropy: %.2f bits (min-entropy %.2f bits)\n", e.Shannon, e.Min)
+	}
+
+	if *unique {
+		return generateUnique(g, *count, generator.BatchOptions{Vars: vars, Attempts: *attempts}, *exclude)
+	}
+
+	var replays []*rng.Recording
+	if *replay != "" {
+		if err := readJSON(*replay, &replays); err != nil {
+			return errors.Wrap(err, "reading replay file")
+		}
+		for n, rec := range replays {
+			if rec == nil {
+				return errors.Errorf("reading replay file: result %d has no recording", n+1)
+			}
+		}
+		*count = len(replays)
+	}
+
+	var recordings []*rng.Recording
+	for n := 0; n < *count; n++ {
+		state := generator.CreateState()
+		state.SetVars(vars)
+
+		if replays != nil {
+			g.UseRandomSource(rng.UseReplay(replays[n]))
+		}
+
+		result, err := g.RunRecorded(state)
+		if err != nil {
+			return err
+		}
+		recordings = append(recordings, result.Recording)
+		fmt.Fprintln(os.Stdout, result.Text)
+		if *ids {
+			fmt.Fprintf(os.Stderr, "IDs: %s\n", strings.Join(result.IDs, " "))
+		}
+	}
+
+	if *record != "" {
+		if err := writeJSON(*record, recordings); err != nil {
+			return errors.Wrap(err, "writing record file")
+		}
+	}
+
+	return nil
+}
+
+// generateUnique prints a batch of distinct results, skipping any listed in the exclude file.
+func generateUnique(g *generator.Generator, count int, opts generator.BatchOptions, exclude string) error {
+	if exclude != "" {
+		var err error
+		if opts.Exclude, err = readLines(exclude); err != nil {
+			return errors.Wrap(err, "reading exclude file")
+		}
+	}
+
+	results, err := g.RunBatch(count, opts)
+	for _, text := range results {
+		fmt.Fprintln(os.Stdout, text)
+	}
+
+	return err
+}
@@ -0,0 +1,80 @@
+/*
+ * Copyright 2020 zpxio (Jeff Sharpe)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/zpxio/octogen/generator"
+	"os"
+)
+
+// runLint implements the 'lint' command, checking the supplied inventories and instructions for
+// problems and printing one issue per line.
+func runLint(args []string) error {
+	fs := flag.NewFlagSet("lint", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: octogen lint -i inventory.yml [options] [instruction...]\n\n")
+		fmt.Fprintf(fs.Output(), "Instructions are read from the arguments and any -f files.\n")
+		fmt.Fprintf(fs.Output(), "Exits with an error if any error-level issue is found.\n\n")
+		fs.PrintDefaults()
+	}
+
+	var inventories, files, vars listFlag
+	fs.Var(&inventories, "i", "inventory `file`, directory or glob to load (repeatable)")
+	strict := fs.Bool("strict", false, "fail if any inventory entry is invalid")
+	format := fs.String("format", "auto", "inventory `format`: auto, yaml, json, toml or csv")
+	fs.Var(&files, "f", "read an instruction from `file` ('-' for stdin, repeatable)")
+	fs.Var(&vars, "var", "`name` of a State variable set before rendering (repeatable)")
+	verbose := fs.Bool("v", false, "enable verbose logging")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	setVerbose(*verbose)
+
+	inv, err := loadInventory(inventories, *strict, *format)
+	if err != nil {
+		return err
+	}
+
+	instructions := fs.Args()
+	for _, file := range files {
+		instruction, err := readInstruction(nil, file)
+		if err != nil {
+			return err
+		}
+		instructions = append(instructions, instruction)
+	}
+
+	issues := generator.Lint(inv, generator.LintOptions{Instructions: instructions, Vars: vars})
+
+	failures := 0
+	for _, issue := range issues {
+		fmt.Fprintln(os.Stdout, issue)
+		if issue.Severity == generator.LintError {
+			failures++
+		}
+	}
+
+	if failures > 0 {
+		return errors.Errorf("%d of %d issues are errors", failures, len(issues))
+	}
+
+	return nil
+}
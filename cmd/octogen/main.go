@@ -17,14 +17,60 @@
 package main
 
 import (
+	"fmt"
 	"github.com/apex/log"
 	"github.com/apex/log/handlers/text"
 	"os"
 )
 
+// command describes a single octogen subcommand.
+type command struct {
+	name    string
+	summary string
+	run     func(args []string) error
+}
+
+var commands = []command{
+	{name: "generate", summary: "Generate text from inventories and an instruction", run: runGenerate},
+	{name: "lint", summary: "Check inventories and instructions for problems", run: runLint},
+	{name: "stats", summary: "Show token probabilities and output distributions", run: runStats},
+	{name: "enumerate", summary: "List every possible output of an instruction", run: runEnumerate},
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: octogen <command> [options]\n\nCommands:\n")
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", c.name, c.summary)
+	}
+	fmt.Fprintf(os.Stderr, "\nRun 'octogen <command> -h' for command options.\n")
+}
+
 func main() {
 	log.SetHandler(text.New(os.Stderr))
+	log.SetLevel(log.WarnLevel)
+
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	name := os.Args[1]
+	if name == "-h" || name == "-help" || name == "--help" || name == "help" {
+		usage()
+		return
+	}
 
-	log.Infof("Starting up.")
+	for _, c := range commands {
+		if c.name == name {
+			if err := c.run(os.Args[2:]); err != nil {
+				fmt.Fprintf(os.Stderr, "octogen %s: %v\n", name, err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
 
+	fmt.Fprintf(os.Stderr, "octogen: unknown command %q\n\n", name)
+	usage()
+	os.Exit(2)
 }
@@ -0,0 +1,138 @@
+/*
+ * Copyright 2020 zpxio (Jeff Sharpe)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/zpxio/octogen/generator"
+	"os"
+	"strings"
+)
+
+// runStats implements the 'stats' command, printing the selection probabilities of the Tokens
+// matching a selector, or the distribution of an instruction's output.
+func runStats(args []string) error {
+	fs := flag.NewFlagSet("stats", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: octogen stats -i inventory.yml [options] [instruction]\n")
+		fmt.Fprintf(fs.Output(), "       octogen stats -i inventory.yml -s selector\n\n")
+		fmt.Fprintf(fs.Output(), "The instruction is read from the argument, the -f file, or stdin.\n\n")
+		fs.PrintDefaults()
+	}
+
+	var inventories, selectors listFlag
+	vars := varFlag{}
+	fs.Var(&inventories, "i", "inventory `file`, directory or glob to load (repeatable)")
+	strict := fs.Bool("strict", false, "fail if any inventory entry is invalid")
+	format := fs.String("format", "auto", "inventory `format`: auto, yaml, json, toml or csv")
+	fs.Var(&selectors, "s", "category or `selector` to list token probabilities for (repeatable)")
+	file := fs.String("f", "", "read the instruction from `file` ('-' for stdin)")
+	fs.Var(vars, "var", "initial State variable as `name=value` (repeatable)")
+	missing := fs.String("missing", "fail", "unmatched selector `policy`: fail, leave, empty, or fallback:Category")
+	top := fs.Int("top", 5, "number of most and least likely outputs to print")
+	verbose := fs.Bool("v", false, "enable verbose logging")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	setVerbose(*verbose)
+
+	policy, err := generator.ParseMissingPolicy(*missing)
+	if err != nil {
+		return err
+	}
+
+	inv, err := loadInventory(inventories, *strict, *format)
+	if err != nil {
+		return err
+	}
+
+	for _, src := range selectors {
+		if !strings.HasPrefix(src, "[") {
+			src = "[" + src + "]"
+		}
+		s, err := generator.CompileSelector(src)
+		if err != nil {
+			return errors.Wrapf(err, "selector %s", src)
+		}
+		printSelectorStats(inv.Stats(s))
+	}
+
+	// Selectors alone don't need an instruction
+	if len(selectors) > 0 && fs.NArg() == 0 && *file == "" {
+		return nil
+	}
+
+	instruction, err := readInstruction(fs.Args(), *file)
+	if err != nil {
+		return err
+	}
+
+	t, err := generator.Compile(instruction)
+	if err != nil {
+		return err
+	}
+
+	state := generator.CreateState()
+	state.SetVars(vars)
+
+	stats, err := generator.AnalyzeTemplate(t, inv, state, policy, *top)
+	if err != nil {
+		return errors.Wrap(err, "analyzing instruction")
+	}
+	printTemplateStats(stats)
+
+	return nil
+}
+
+// printSelectorStats prints the probability of each Token matching a selector.
+func printSelectorStats(stats *generator.SelectorStats) {
+	fmt.Fprintf(os.Stdout, "%s: %d tokens, entropy %.2f bits, %.2f effective choices\n",
+		stats.Selector, len(stats.Tokens), stats.Entropy, stats.Effective)
+
+	for _, t := range stats.Tokens {
+		label := t.Token.Content
+		if t.Token.ID != "" {
+			label += fmt.Sprintf(" (id %s)", t.Token.ID)
+		}
+		fmt.Fprintf(os.Stdout, "  %8.4f%%  rarity %-6g %s\n", 100*t.Probability, t.Token.Rarity, label)
+	}
+}
+
+// printTemplateStats prints the distribution of an instruction's output.
+func printTemplateStats(stats *generator.TemplateStats) {
+	fmt.Fprintf(os.Stdout, "Distinct outputs: %d\n", stats.Outputs)
+	fmt.Fprintf(os.Stdout, "Entropy: %.2f bits (min-entropy %.2f bits), %.2f effective choices\n",
+		stats.Entropy.Shannon, stats.Entropy.Min, stats.Effective)
+
+	printOutputs("Most likely", stats.MostLikely)
+	printOutputs("Least likely", stats.LeastLikely)
+}
+
+// printOutputs prints a titled list of outputs with their probabilities.
+func printOutputs(title string, outputs []generator.OutputStats) {
+	if len(outputs) == 0 {
+		return
+	}
+
+	fmt.Fprintf(os.Stdout, "%s:\n", title)
+	for _, o := range outputs {
+		fmt.Fprintf(os.Stdout, "  %8.4f%%  %s\n", 100*o.Probability, o.Text)
+	}
+}
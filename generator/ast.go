@@ -0,0 +1,131 @@
+/*
+ * Copyright 2020 zpxio (Jeff Sharpe)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package generator
+
+// node is a single element of a parsed instruction. Nodes record the byte offset at which they
+// started in the source text, so that errors can point at the offending part of an instruction.
+type node interface {
+	position() int
+}
+
+// textNode is literal text which is copied to the output unchanged.
+type textNode struct {
+	pos  int
+	text string
+}
+
+// varNode is a reference to a State variable, written as [$name].
+type varNode struct {
+	pos  int
+	raw  string
+	name string
+}
+
+// selectorNode selects a Token from the Inventory, written as [Category:options]. The values of
+// options may contain nested variable or selector nodes, which are rendered before the selection.
+// Selectors written as [Category:options#name] capture the picked Token under the name.
+type selectorNode struct {
+	pos      int
+	raw      string
+	category string
+	options  []optionNode
+	capture  string
+}
+
+// captureNode refers to a captured Token, written as [#name] for its rendered content or
+// [#name.property] for one of its Properties.
+type captureNode struct {
+	pos      int
+	raw      string
+	name     string
+	property string
+}
+
+// refNode refers to a State variable or captured Token within a selector option value, written as
+// $name, #name or #name.property. Unlike tags, references which can't be resolved are errors.
+type refNode struct {
+	pos      int
+	raw      string
+	capture  bool
+	name     string
+	property string
+}
+
+// optionNode is a single property filter within a selectorNode. The op is one of the selector
+// option types (optTypeRequire, optTypeExclude or optTypeExists).
+type optionNode struct {
+	key   string
+	op    string
+	value []node
+}
+
+// altNode picks one of several alternatives at random, written as {a|b:2|c}. Alternatives may
+// contain tags and further alternations.
+type altNode struct {
+	pos     int
+	choices []choiceNode
+	total   float64
+}
+
+// choiceNode is a single alternative within an altNode. The weight sets its chance of being picked
+// relative to the other alternatives, like a Token's Rarity.
+type choiceNode struct {
+	weight float64
+	nodes  []node
+}
+
+// ifNode renders one of two branches depending on a State variable, written as
+// {if $name=value}...{else}...{end}. The else branch is optional.
+type ifNode struct {
+	pos       int
+	cond      condition
+	then      []node
+	otherwise []node
+}
+
+// condition tests a State variable. The op is one of the selector option types: optTypeExists
+// checks that the variable is set to a non-empty value, while optTypeRequire and optTypeExclude
+// compare it to the value. Negated conditions hold when the test fails.
+type condition struct {
+	name   string
+	op     string
+	value  string
+	negate bool
+}
+
+// repeatNode renders its body a number of times, written as
+// {repeat 2..4 sep=", " last=" and " unique}...{end}. The count is picked uniformly between min and
+// max. The sep text is written between repetitions, except before the last one, which is preceded by
+// the last text. Unique loops don't pick the same Token twice.
+type repeatNode struct {
+	pos    int
+	min    int
+	max    int
+	sep    string
+	last   string
+	unique bool
+	body   []node
+}
+
+func (n *textNode) position() int     { return n.pos }
+func (n *varNode) position() int      { return n.pos }
+func (n *selectorNode) position() int { return n.pos }
+func (n *captureNode) position() int  { return n.pos }
+func (n *refNode) position() int      { return n.pos }
+func (n *altNode) position() int      { return n.pos }
+func (n *ifNode) position() int       { return n.pos }
+func (n *repeatNode) position() int   { return n.pos }
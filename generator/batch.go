@@ -0,0 +1,118 @@
+/*
+ * Copyright 2020 zpxio (Jeff Sharpe)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package generator
+
+import (
+	"github.com/pkg/errors"
+)
+
+// BatchAttemptFactor sets the default attempt budget of a batch, as a multiple of the number of
+// outputs requested.
+const BatchAttemptFactor = 10
+
+// BatchOptions configures RunBatch.
+type BatchOptions struct {
+	// Vars are the initial State variables for every run.
+	Vars map[string]string
+	// Attempts is the maximum number of runs. If it isn't positive, BatchAttemptFactor runs are
+	// allowed for every output requested.
+	Attempts int
+	// Exclude lists outputs which must not be produced, such as names which are already in use.
+	Exclude []string
+}
+
+// RunBatch runs the generator until it has produced n distinct outputs, which are returned in the
+// order they were generated. Outputs listed in the options' Exclude set are never returned.
+//
+// Before running, the Template's possible outputs are enumerated, and ErrOutputSpaceTooSmall is
+// returned if fewer than n of them remain after exclusions. Templates with more than ExploreLimit
+// possible renders aren't checked. If the attempt budget runs out, the outputs produced so far are
+// returned with ErrAttemptsExhausted. A run which fails stops the batch in the same way, returning
+// its error. An error is returned if n is less than 1.
+func (g *Generator) RunBatch(n int, opts BatchOptions) ([]string, error) {
+	if g.err != nil {
+		return nil, g.err
+	}
+	if n < 1 {
+		return nil, errors.Errorf("batch size must be at least 1, got %d", n)
+	}
+
+	seen := make(map[string]bool, len(opts.Exclude)+n)
+	for _, text := range opts.Exclude {
+		seen[text] = true
+	}
+
+	if err := g.checkOutputSpace(n, opts.Vars, seen); err != nil {
+		return nil, err
+	}
+
+	attempts := opts.Attempts
+	if attempts <= 0 {
+		attempts = n * BatchAttemptFactor
+	}
+
+	outputs := make([]string, 0, n)
+	for attempt := 0; attempt < attempts && len(outputs) < n; attempt++ {
+		state := CreateState()
+		state.SetVars(opts.Vars)
+
+		text, _, err := g.render(state, g.source())
+		if err != nil {
+			return outputs, err
+		}
+		if seen[text] {
+			continue
+		}
+
+		seen[text] = true
+		outputs = append(outputs, text)
+	}
+
+	if len(outputs) < n {
+		return outputs, errors.Wrapf(ErrAttemptsExhausted, "%d of %d outputs after %d attempts", len(outputs), n, attempts)
+	}
+
+	return outputs, nil
+}
+
+// checkOutputSpace enumerates the Template's outputs, failing if fewer than n of them aren't
+// excluded. Enumeration stops as soon as enough outputs are found.
+func (g *Generator) checkOutputSpace(n int, vars map[string]string, excluded map[string]bool) error {
+	state := CreateState()
+	state.SetVars(vars)
+
+	available := make(map[string]bool)
+	complete, err := Enumerate(g.template, g.Inventory(), state, g.missing, 0, func(e Enumeration) error {
+		if !excluded[e.Text] {
+			available[e.Text] = true
+		}
+		if len(available) >= n {
+			return ErrStopEnumeration
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if complete && len(available) < n {
+		return errors.Wrapf(ErrOutputSpaceTooSmall, "%d distinct outputs available, %d requested", len(available), n)
+	}
+
+	return nil
+}
@@ -0,0 +1,133 @@
+/*
+ * Copyright 2020 zpxio (Jeff Sharpe)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package generator
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/suite"
+	"github.com/zpxio/octogen/rng"
+	"testing"
+)
+
+type BatchSuite struct {
+	suite.Suite
+}
+
+func TestBatchSuite(t *testing.T) {
+	suite.Run(t, new(BatchSuite))
+}
+
+// buildBatchGenerator creates a seeded generator for the template, with 100 possible outputs.
+func buildBatchGenerator(template string) *Generator {
+	i := CreateInventory()
+	for n := 0; n < 10; n++ {
+		i.AddToken("Digit", fmt.Sprint(n), 1.0, Properties{})
+	}
+
+	g := CreateGenerator(template, i)
+	g.UseRandomSource(rng.UseSeeded(42))
+
+	return g
+}
+
+func (s *BatchSuite) TestRunBatch() {
+	g := buildBatchGenerator("[Digit][Digit]")
+
+	outputs, err := g.RunBatch(50, BatchOptions{})
+
+	s.Require().NoError(err)
+	s.Len(outputs, 50)
+	seen := make(map[string]bool)
+	for _, text := range outputs {
+		s.False(seen[text], text)
+		seen[text] = true
+	}
+}
+
+func (s *BatchSuite) TestRunBatch_WholeSpace() {
+	g := buildBatchGenerator("[Digit][Digit]")
+
+	outputs, err := g.RunBatch(100, BatchOptions{Attempts: 100000})
+
+	s.NoError(err)
+	s.Len(outputs, 100)
+}
+
+func (s *BatchSuite) TestRunBatch_TooSmall() {
+	g := buildBatchGenerator("[Digit][Digit]")
+
+	outputs, err := g.RunBatch(101, BatchOptions{})
+
+	s.Equal(ErrOutputSpaceTooSmall, errors.Cause(err))
+	s.Nil(outputs)
+}
+
+func (s *BatchSuite) TestRunBatch_InvalidSize() {
+	g := buildBatchGenerator("[Digit]")
+
+	for _, n := range []int{0, -1} {
+		outputs, err := g.RunBatch(n, BatchOptions{})
+
+		s.Error(err)
+		s.Nil(outputs)
+	}
+}
+
+func (s *BatchSuite) TestRunBatch_Exclude() {
+	g := buildBatchGenerator("[Digit]")
+
+	outputs, err := g.RunBatch(8, BatchOptions{Exclude: []string{"3", "7"}, Attempts: 10000})
+
+	s.Require().NoError(err)
+	s.Len(outputs, 8)
+	s.NotContains(outputs, "3")
+	s.NotContains(outputs, "7")
+
+	_, err = g.RunBatch(9, BatchOptions{Exclude: []string{"3", "7"}})
+
+	s.Equal(ErrOutputSpaceTooSmall, errors.Cause(err))
+}
+
+func (s *BatchSuite) TestRunBatch_Vars() {
+	g := buildBatchGenerator("[$prefix]-[Digit]")
+
+	outputs, err := g.RunBatch(10, BatchOptions{Vars: map[string]string{"prefix": "X"}, Attempts: 10000})
+
+	s.Require().NoError(err)
+	s.Len(outputs, 10)
+	s.Contains(outputs, "X-0")
+}
+
+func (s *BatchSuite) TestRunBatch_AttemptsExhausted() {
+	g := buildBatchGenerator("[Digit][Digit]")
+
+	outputs, err := g.RunBatch(50, BatchOptions{Attempts: 20})
+
+	s.Equal(ErrAttemptsExhausted, errors.Cause(err))
+	s.True(len(outputs) <= 20)
+	s.NotEmpty(outputs)
+}
+
+func (s *BatchSuite) TestRunBatch_Missing() {
+	g := buildBatchGenerator("[Letter]")
+	g.UseMissingPolicy(FailOnMissing)
+
+	_, err := g.RunBatch(5, BatchOptions{})
+
+	s.IsType(&NoMatchError{}, err)
+}
@@ -0,0 +1,52 @@
+/*
+ * Copyright 2020 zpxio (Jeff Sharpe)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package generator
+
+import "math"
+
+// Entropy describes how unpredictable the output of a Template is, measured in bits. The estimate is
+// based on the random Token choices made while rendering. Different choices which happen to render
+// the same text are counted separately, so the figures are upper bounds when an Inventory contains
+// duplicate content.
+type Entropy struct {
+	// Shannon is the average information content of a render.
+	Shannon float64
+	// Min is the min-entropy: the information content of the single most likely render. This is the
+	// conservative figure to use when describing the strength of generated secrets.
+	Min float64
+}
+
+// EstimateEntropy calculates the Entropy of rendering the Template with the Inventory, starting from
+// the given State. Selectors which don't match any Token are handled according to the MissingPolicy,
+// and an error is returned if any possible render would fail.
+func EstimateEntropy(t *Template, i *Inventory, state *State, policy MissingPolicy) (Entropy, error) {
+	x := newExplorer(i, policy, true)
+
+	e := Entropy{Min: math.Inf(1)}
+	err := x.explore(t, state, func(o outcome) error {
+		surprise := -math.Log2(o.prob)
+		e.Shannon += o.prob * (surprise + o.bits)
+		e.Min = math.Min(e.Min, surprise+o.minBits)
+
+		return nil
+	})
+	if err != nil {
+		return Entropy{}, err
+	}
+
+	return e, nil
+}
@@ -0,0 +1,154 @@
+/*
+ * Copyright 2020 zpxio (Jeff Sharpe)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package generator
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/suite"
+	"math"
+	"testing"
+)
+
+type EntropySuite struct {
+	suite.Suite
+}
+
+func TestEntropySuite(t *testing.T) {
+	suite.Run(t, new(EntropySuite))
+}
+
+func uniformInventory(category string, n int) *Inventory {
+	i := CreateInventory()
+	for x := 0; x < n; x++ {
+		i.AddToken(category, fmt.Sprintf("%s%d", category, x), 1.0, Properties{})
+	}
+
+	return i
+}
+
+func (s *EntropySuite) TestEstimateEntropy_Uniform() {
+	i := uniformInventory("Word", 1024)
+
+	e, err := EstimateEntropy(MustCompile("[Word]-[Word]-[Word]"), i, nil, FailOnMissing)
+
+	s.NoError(err)
+	s.InDelta(30.0, e.Shannon, 1e-9)
+	s.InDelta(30.0, e.Min, 1e-9)
+}
+
+func (s *EntropySuite) TestEstimateEntropy_Weighted() {
+	i := BuildSampleInventory()
+
+	e, err := EstimateEntropy(MustCompile("[Animal]"), i, nil, FailOnMissing)
+
+	// Rarities 1, 2, 1 and 2.5 out of 6.5
+	expected := 0.0
+	for _, r := range []float64{1, 2, 1, 2.5} {
+		expected -= r / 6.5 * math.Log2(r/6.5)
+	}
+
+	s.NoError(err)
+	s.InDelta(expected, e.Shannon, 1e-9)
+	s.InDelta(-math.Log2(2.5/6.5), e.Min, 1e-9)
+}
+
+func (s *EntropySuite) TestEstimateEntropy_Static() {
+	i := BuildSampleInventory()
+
+	e, err := EstimateEntropy(MustCompile("Nothing random [$x]"), i, nil, FailOnMissing)
+
+	s.NoError(err)
+	s.Equal(0.0, e.Shannon)
+	s.Equal(0.0, e.Min)
+}
+
+func (s *EntropySuite) TestEstimateEntropy_Nested() {
+	i := CreateInventory()
+	i.AddToken("Type", "a", 1.0, Properties{})
+	i.AddToken("Type", "b", 1.0, Properties{})
+	i.AddToken("Item", "a1", 1.0, Properties{"type": "a"})
+	i.AddToken("Item", "a2", 1.0, Properties{"type": "a"})
+	i.AddToken("Item", "a3", 1.0, Properties{"type": "a"})
+	i.AddToken("Item", "a4", 1.0, Properties{"type": "a"})
+	i.AddToken("Item", "b1", 1.0, Properties{"type": "b"})
+
+	e, err := EstimateEntropy(MustCompile("[Item:type=[Type]]"), i, nil, FailOnMissing)
+
+	// One bit for the type, then two bits half of the time
+	s.NoError(err)
+	s.InDelta(2.0, e.Shannon, 1e-9)
+	s.InDelta(1.0, e.Min, 1e-9)
+}
+
+func (s *EntropySuite) TestEstimateEntropy_SetVars() {
+	i := CreateInventory()
+	i.AddToken("Size", "big", 1.0, Properties{}).OnRenderSet("size", "big")
+	i.AddToken("Size", "small", 3.0, Properties{}).OnRenderSet("size", "small")
+	i.AddToken("Thing", "boulder", 1.0, Properties{"size": "big"})
+	i.AddToken("Thing", "mountain", 1.0, Properties{"size": "big"})
+	i.AddToken("Thing", "pebble", 1.0, Properties{"size": "small"})
+
+	e, err := EstimateEntropy(MustCompile("[Size] [Thing:size=[$size]]"), i, nil, FailOnMissing)
+
+	hSize := -(0.25*math.Log2(0.25) + 0.75*math.Log2(0.75))
+	s.NoError(err)
+	s.InDelta(hSize+0.25, e.Shannon, 1e-9)
+	s.InDelta(-math.Log2(0.75), e.Min, 1e-9)
+}
+
+func (s *EntropySuite) TestEstimateEntropy_State() {
+	i := BuildSampleInventory()
+	x := CreateState()
+	x.Vars["type"] = "mammal"
+
+	e, err := EstimateEntropy(MustCompile("[Animal:type=[$type]]"), i, x, FailOnMissing)
+
+	s.NoError(err)
+	s.InDelta(1.0, e.Shannon, 1e-9)
+}
+
+func (s *EntropySuite) TestEstimateEntropy_NoMatch() {
+	i := BuildSampleInventory()
+
+	_, err := EstimateEntropy(MustCompile("[Animal:type=bird]"), i, nil, FailOnMissing)
+	s.IsType(&NoMatchError{}, err)
+
+	e, err := EstimateEntropy(MustCompile("[Animal:type=bird]"), i, nil, FallbackMissing("Animal"))
+	s.NoError(err)
+	s.True(e.Shannon > 1.0)
+}
+
+func (s *EntropySuite) TestEstimateEntropy_TooMany() {
+	i := CreateInventory()
+	for x := 0; x < 200; x++ {
+		i.AddToken("Word", fmt.Sprintf("w%d", x), 1.0, Properties{}).OnRenderSet("last", fmt.Sprintf("w%d", x))
+	}
+
+	_, err := EstimateEntropy(MustCompile("[Word][Word][Word]"), i, nil, FailOnMissing)
+
+	s.Equal(ErrTooManyOutcomes, err)
+}
+
+func (s *EntropySuite) TestEstimateEntropy_Capture() {
+	i := uniformInventory("Word", 8)
+
+	e, err := EstimateEntropy(MustCompile("[Word#w] [#w] [#w]"), i, nil, FailOnMissing)
+
+	s.NoError(err)
+	s.InDelta(3.0, e.Shannon, 1e-9)
+	s.InDelta(3.0, e.Min, 1e-9)
+}
@@ -0,0 +1,69 @@
+/*
+ * Copyright 2020 zpxio (Jeff Sharpe)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package generator
+
+import (
+	"github.com/pkg/errors"
+)
+
+// ErrStopEnumeration may be returned by an Enumerate callback to stop the enumeration early without
+// reporting an error.
+var ErrStopEnumeration = errors.New("stop enumeration")
+
+// Enumeration is a single way of rendering a Template, reached by a particular sequence of Token
+// choices.
+type Enumeration struct {
+	// Text is the rendered output.
+	Text string
+	// Probability is the chance of a render making exactly these choices.
+	Probability float64
+	// IDs lists the IDs of the Tokens picked, in the order they were picked. Tokens without an ID
+	// aren't listed.
+	IDs []string
+}
+
+// Enumerate renders the Template with every possible combination of Token choices, calling fn with
+// each result, starting from the given State. Selector options, variables set by picked Tokens and
+// nested content are all followed as they would be by a render. Results are produced in Inventory
+// order, and different choices which render the same text are produced separately.
+//
+// At most limit results are produced, or ExploreLimit if limit isn't positive. The returned flag is
+// true if every result was produced. Enumeration stops at the first error returned by fn, which is
+// returned unless it is ErrStopEnumeration. Selectors which don't match any Token are handled
+// according to the MissingPolicy, and enumeration stops with an error at the first render which would
+// fail.
+func Enumerate(t *Template, i *Inventory, state *State, policy MissingPolicy, limit int, fn func(e Enumeration) error) (bool, error) {
+	x := newExplorer(i, policy, false)
+	if limit > 0 && limit < x.limit {
+		x.limit = limit
+	}
+
+	err := x.explore(t, state, func(o outcome) error {
+		return fn(Enumeration{Text: o.text, Probability: o.prob, IDs: o.picked})
+	})
+
+	switch errors.Cause(err) {
+	case nil:
+		return true, nil
+	case ErrTooManyOutcomes:
+		return false, nil
+	case ErrStopEnumeration:
+		return false, nil
+	}
+
+	return false, err
+}
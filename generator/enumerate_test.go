@@ -0,0 +1,265 @@
+/*
+ * Copyright 2020 zpxio (Jeff Sharpe)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package generator
+
+import (
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/suite"
+	"testing"
+)
+
+type EnumerateSuite struct {
+	suite.Suite
+}
+
+func TestEnumerateSuite(t *testing.T) {
+	suite.Run(t, new(EnumerateSuite))
+}
+
+// collect enumerates the Template, returning every result.
+func collect(t *Template, i *Inventory, limit int) ([]Enumeration, bool, error) {
+	var results []Enumeration
+	complete, err := Enumerate(t, i, nil, FailOnMissing, limit, func(e Enumeration) error {
+		results = append(results, e)
+		return nil
+	})
+
+	return results, complete, err
+}
+
+func (s *EnumerateSuite) TestEnumerate() {
+	i := BuildSampleInventory()
+
+	results, complete, err := collect(MustCompile("[Description:tone=negative] [Animal:type=mammal]"), i, 0)
+
+	s.Require().NoError(err)
+	s.True(complete)
+	s.Require().Len(results, 4)
+	s.Equal("Angry Aardvark", results[0].Text)
+	s.InDelta(0.2, results[0].Probability, 1e-9)
+	s.Equal("Angry Capybara", results[1].Text)
+	s.Equal("Confused Aardvark", results[2].Text)
+	s.InDelta(0.3, results[3].Probability, 1e-9)
+	s.Equal("Confused Capybara", results[3].Text)
+}
+
+func (s *EnumerateSuite) TestEnumerate_Nested() {
+	i := CreateInventory()
+	i.AddToken("Type", "a", 1.0, Properties{})
+	i.AddToken("Type", "b", 3.0, Properties{})
+	i.AddToken("Item", "a1", 1.0, Properties{"type": "a"})
+	i.AddToken("Item", "a2 [Type]", 1.0, Properties{"type": "a"})
+	i.AddToken("Item", "b1", 1.0, Properties{"type": "b"})
+
+	results, _, err := collect(MustCompile("[Item:type=[Type]]"), i, 0)
+
+	s.Require().NoError(err)
+	texts := make([]string, 0, len(results))
+	total := 0.0
+	for _, r := range results {
+		texts = append(texts, r.Text)
+		total += r.Probability
+	}
+	s.Equal([]string{"a1", "a2 a", "a2 b", "b1"}, texts)
+	s.InDelta(0.125*0.25, results[1].Probability, 1e-9)
+	s.InDelta(1.0, total, 1e-9)
+}
+
+func (s *EnumerateSuite) TestEnumerate_SetVars() {
+	i := CreateInventory()
+	t := BuildToken("Hero", "Alice", 1.0, Properties{})
+	t.OnRenderSet("pronoun", "she")
+	t.ID = "alice"
+	i.Add(t)
+	t = BuildToken("Hero", "Bob", 1.0, Properties{})
+	t.OnRenderSet("pronoun", "he")
+	i.Add(t)
+
+	results, _, err := collect(MustCompile("[Hero] said [$pronoun] would go"), i, 0)
+
+	s.Require().NoError(err)
+	s.Require().Len(results, 2)
+	s.Equal("Alice said she would go", results[0].Text)
+	s.Equal([]string{"alice"}, results[0].IDs)
+	s.Equal("Bob said he would go", results[1].Text)
+	s.Empty(results[1].IDs)
+}
+
+func (s *EnumerateSuite) TestEnumerate_Alternation() {
+	i := BuildSampleInventory()
+
+	results, _, err := collect(MustCompile("{a:3|the} [Animal:type={fish|cryptid}]"), i, 0)
+
+	s.Require().NoError(err)
+	s.Require().Len(results, 4)
+	s.Equal("a Cladoselache", results[0].Text)
+	s.InDelta(0.375, results[0].Probability, 1e-9)
+	s.Equal("a Boomalope", results[1].Text)
+	s.Equal("the Cladoselache", results[2].Text)
+	s.InDelta(0.125, results[3].Probability, 1e-9)
+}
+
+func (s *EnumerateSuite) TestEnumerate_Conditional() {
+	i := CreateInventory()
+	t := BuildToken("Hero", "Alice", 1.0, Properties{})
+	t.OnRenderSet("gender", "female")
+	i.Add(t)
+	t = BuildToken("Hero", "Bob", 3.0, Properties{})
+	t.OnRenderSet("gender", "male")
+	i.Add(t)
+
+	results, _, err := collect(MustCompile("[Hero] lost {if $gender=female}her{else}his{end} map"), i, 0)
+
+	s.Require().NoError(err)
+	s.Require().Len(results, 2)
+	s.Equal("Alice lost her map", results[0].Text)
+	s.Equal("Bob lost his map", results[1].Text)
+	s.InDelta(0.75, results[1].Probability, 1e-9)
+}
+
+func (s *EnumerateSuite) TestEnumerate_Repeat() {
+	i := CreateInventory()
+	i.AddToken("Word", "a", 1.0, Properties{})
+	i.AddToken("Word", "b", 1.0, Properties{})
+
+	results, _, err := collect(MustCompile(`{repeat 1..2 sep="+"}[Word]{end}`), i, 0)
+
+	s.Require().NoError(err)
+	texts := make([]string, 0, len(results))
+	total := 0.0
+	for _, r := range results {
+		texts = append(texts, r.Text)
+		total += r.Probability
+	}
+	s.Equal([]string{"a", "b", "a+a", "a+b", "b+a", "b+b"}, texts)
+	s.InDelta(0.25, results[0].Probability, 1e-9)
+	s.InDelta(0.125, results[2].Probability, 1e-9)
+	s.InDelta(1.0, total, 1e-9)
+}
+
+func (s *EnumerateSuite) TestEnumerate_RepeatUnique() {
+	i := CreateInventory()
+	i.AddToken("Word", "a", 1.0, Properties{})
+	i.AddToken("Word", "b", 3.0, Properties{})
+
+	results, _, err := collect(MustCompile(`{repeat 2 unique}[Word]{end} [Word]`), i, 0)
+
+	s.Require().NoError(err)
+	s.Require().Len(results, 4)
+	s.Equal("ab a", results[0].Text)
+	s.InDelta(0.25*0.25, results[0].Probability, 1e-9)
+	s.Equal("ab b", results[1].Text)
+	s.Equal("ba a", results[2].Text)
+	s.InDelta(0.75*0.25, results[2].Probability, 1e-9)
+}
+
+func (s *EnumerateSuite) TestEnumerate_Capture() {
+	i := BuildSampleInventory()
+
+	results, _, err := collect(MustCompile("[Animal:type=mammal#a] is a [#a.family], [#a]"), i, 0)
+
+	s.Require().NoError(err)
+	s.Require().Len(results, 2)
+	s.Equal("Aardvark is a orycteropod, Aardvark", results[0].Text)
+	s.InDelta(0.5, results[0].Probability, 1e-9)
+	s.Equal("Capybara is a rodent, Capybara", results[1].Text)
+}
+
+func (s *EnumerateSuite) TestEnumerate_CaptureFilter() {
+	i := BuildSampleInventory()
+	i.AddToken("Food", "grubs", 1.0, Properties{"diet": "orycteropod"})
+	i.AddToken("Food", "grass", 1.0, Properties{"diet": "rodent"})
+	i.AddToken("Food", "hay", 3.0, Properties{"diet": "rodent"})
+
+	results, _, err := collect(MustCompile("[Animal:type=mammal#a] eats [Food:diet=#a.family]"), i, 0)
+
+	s.Require().NoError(err)
+	s.Require().Len(results, 3)
+	s.Equal("Aardvark eats grubs", results[0].Text)
+	s.InDelta(0.5, results[0].Probability, 1e-9)
+	s.Equal("Capybara eats grass", results[1].Text)
+	s.InDelta(0.125, results[1].Probability, 1e-9)
+	s.Equal("Capybara eats hay", results[2].Text)
+}
+
+func (s *EnumerateSuite) TestEnumerate_UnresolvedReference() {
+	_, _, err := collect(MustCompile("[Animal:env=$habitat]"), BuildSampleInventory(), 0)
+
+	s.IsType(&ReferenceError{}, err)
+}
+
+func (s *EnumerateSuite) TestEnumerate_Limit() {
+	i := BuildSampleInventory()
+
+	results, complete, err := collect(MustCompile("[Animal]"), i, 3)
+
+	s.NoError(err)
+	s.False(complete)
+	s.Len(results, 3)
+
+	results, complete, err = collect(MustCompile("[Animal]"), i, 4)
+
+	s.NoError(err)
+	s.True(complete)
+	s.Len(results, 4)
+}
+
+func (s *EnumerateSuite) TestEnumerate_Stop() {
+	i := BuildSampleInventory()
+	count := 0
+
+	complete, err := Enumerate(MustCompile("[Animal]"), i, nil, FailOnMissing, 0, func(e Enumeration) error {
+		count++
+		return ErrStopEnumeration
+	})
+
+	s.NoError(err)
+	s.False(complete)
+	s.Equal(1, count)
+}
+
+func (s *EnumerateSuite) TestEnumerate_CallbackError() {
+	i := BuildSampleInventory()
+	failure := errors.New("failed")
+
+	_, err := Enumerate(MustCompile("[Animal]"), i, nil, FailOnMissing, 0, func(e Enumeration) error {
+		return failure
+	})
+
+	s.Equal(failure, err)
+}
+
+func (s *EnumerateSuite) TestEnumerate_Missing() {
+	_, _, err := collect(MustCompile("[Plant]"), BuildSampleInventory(), 0)
+
+	s.IsType(&NoMatchError{}, err)
+}
+
+func (s *EnumerateSuite) TestGenerator_Enumerate() {
+	g, err := CompileGenerator("[Animal:type=fish]", BuildSampleInventory())
+	s.Require().NoError(err)
+
+	var texts []string
+	complete, err := g.Enumerate(nil, 0, func(e Enumeration) error {
+		texts = append(texts, e.Text)
+		return nil
+	})
+
+	s.NoError(err)
+	s.True(complete)
+	s.Equal([]string{"Cladoselache"}, texts)
+}
@@ -0,0 +1,121 @@
+/*
+ * Copyright 2020 zpxio (Jeff Sharpe)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package generator
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"strings"
+)
+
+// ErrInsecureSource is returned when a Generator requiring a secure RandomSource is run with a source
+// which isn't cryptographically secure.
+var ErrInsecureSource = errors.New("generator requires a cryptographically secure random source")
+
+// ErrTokenNotFound is returned when no Token in an Inventory has the requested ID.
+var ErrTokenNotFound = errors.New("token not found")
+
+// ErrDuplicateID is returned when a change would leave two Tokens in an Inventory with the same ID.
+var ErrDuplicateID = errors.New("duplicate token ID")
+
+// ErrFrozen is returned when Tokens are merged or loaded into a frozen Inventory.
+var ErrFrozen = errors.New("inventory is frozen")
+
+// ErrOutputSpaceTooSmall is returned when a batch asks for more unique outputs than the Template can
+// produce.
+var ErrOutputSpaceTooSmall = errors.New("template can't produce enough distinct outputs")
+
+// ErrAttemptsExhausted is returned when a batch runs out of attempts before producing enough unique
+// outputs.
+var ErrAttemptsExhausted = errors.New("ran out of attempts to generate unique outputs")
+
+// NoMatchError is returned when a Selector in an instruction doesn't match any Token in the
+// Inventory and the MissingPolicy in use requires rendering to fail.
+type NoMatchError struct {
+	// Selector is the parsed Selector which failed to match.
+	Selector *Selector
+	// Category is the Category that was searched.
+	Category string
+	// Tag is the text of the selector tag as it appeared when it was rendered.
+	Tag string
+	// Position is the byte offset of the tag within the text being rendered.
+	Position int
+}
+
+// Error describes the unmatched selector.
+func (e *NoMatchError) Error() string {
+	return fmt.Sprintf("no token matches %s in category %q at position %d", e.Tag, e.Category, e.Position)
+}
+
+// SyntaxError is returned when instruction text can't be parsed.
+type SyntaxError struct {
+	// Position is the byte offset of the error within the instruction.
+	Position int
+	// Line and Column give the 1-based location of the error within the instruction.
+	Line   int
+	Column int
+	// Msg describes the problem.
+	Msg string
+}
+
+// newSyntaxError builds a SyntaxError for the given offset within the source text.
+func newSyntaxError(src string, pos int, format string, args ...interface{}) *SyntaxError {
+	line := 1 + strings.Count(src[:pos], "\n")
+	column := pos - strings.LastIndex(src[:pos], "\n")
+
+	return &SyntaxError{
+		Position: pos,
+		Line:     line,
+		Column:   column,
+		Msg:      fmt.Sprintf(format, args...),
+	}
+}
+
+// Error describes the syntax error and its location.
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("syntax error at line %d, column %d: %s", e.Line, e.Column, e.Msg)
+}
+
+// DepthError is returned when Token content references other Tokens more deeply than RoundsMax
+// allows, which usually indicates a cycle of categories referencing each other.
+type DepthError struct {
+	// Category is the Category of the Token whose content could not be rendered.
+	Category string
+	// Depth is the nesting depth that was reached.
+	Depth int
+}
+
+// Error describes the nesting that was too deep.
+func (e *DepthError) Error() string {
+	return fmt.Sprintf("token content in category %q nested %d levels deep; check for cyclic references", e.Category, e.Depth)
+}
+
+// ReferenceError is returned when a selector option refers to a State variable or capture which
+// can't be resolved when the selector picks a Token.
+type ReferenceError struct {
+	// Reference is the reference as written, such as "$habitat" or "#hero.diet".
+	Reference string
+	// Position is the byte offset of the reference within the instruction or Token content.
+	Position int
+	// Reason describes why the reference couldn't be resolved.
+	Reason string
+}
+
+// Error describes the reference and why it couldn't be resolved.
+func (e *ReferenceError) Error() string {
+	return fmt.Sprintf("unresolved reference %s at position %d: %s", e.Reference, e.Position, e.Reason)
+}
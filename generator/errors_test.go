@@ -0,0 +1,42 @@
+/*
+ * Copyright 2020 zpxio (Jeff Sharpe)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package generator
+
+import (
+	"github.com/stretchr/testify/suite"
+	"testing"
+)
+
+type ErrorsSuite struct {
+	suite.Suite
+}
+
+func TestErrorsSuite(t *testing.T) {
+	suite.Run(t, new(ErrorsSuite))
+}
+
+func (s *ErrorsSuite) TestNoMatchError() {
+	err := &NoMatchError{Selector: ParseSelector("Animal", ""), Category: "Animal", Tag: "[Animal]", Position: 4}
+
+	s.Equal(`no token matches [Animal] in category "Animal" at position 4`, err.Error())
+}
+
+func (s *ErrorsSuite) TestReferenceError() {
+	err := &ReferenceError{Reference: "$habitat", Position: 12, Reason: `variable "habitat" is not set`}
+
+	s.Equal(`unresolved reference $habitat at position 12: variable "habitat" is not set`, err.Error())
+}
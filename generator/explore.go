@@ -0,0 +1,362 @@
+/*
+ * Copyright 2020 zpxio (Jeff Sharpe)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package generator
+
+import (
+	"github.com/pkg/errors"
+	"math"
+)
+
+// ExploreLimit is the maximum number of distinct outcomes examined when analyzing a Template.
+const ExploreLimit = 1000000
+
+// ErrTooManyOutcomes is returned when analyzing a Template would require examining more than
+// ExploreLimit distinct outcomes.
+var ErrTooManyOutcomes = errors.New("template has too many possible outcomes to analyze")
+
+// outcome is a partially or fully rendered result reached by a particular sequence of Token choices.
+type outcome struct {
+	// text is the output rendered so far
+	text string
+	// vars are the State variables at this point; the map is shared and must be copied to modify it
+	vars map[string]string
+	// prob is the probability of the choices made to reach this outcome
+	prob float64
+	// picked lists the IDs of the Tokens picked so far; the slice is shared and must be copied to
+	// extend it
+	picked []string
+	// captures holds the Tokens captured so far; the map is shared and must be copied to modify it
+	captures map[string]Capture
+	// used holds the identities of the Tokens picked within a unique {repeat} block, like the
+	// renderer's; the map is shared and must be copied to modify it
+	used map[string]bool
+	// bits and minBits are the Shannon entropy and min-entropy of choices which were summarized
+	// rather than branched upon
+	bits    float64
+	minBits float64
+}
+
+// explorer walks a parsed instruction like a renderer, but follows every possible Token choice
+// rather than picking one. Each complete outcome is passed to a callback along with its probability.
+type explorer struct {
+	inventory *Inventory
+	missing   MissingPolicy
+
+	// summarize enables treating choices which can't affect the rest of the render as a single
+	// outcome, recording their entropy instead of branching. The text of such outcomes is not exact.
+	summarize bool
+
+	limit    int
+	outcomes int
+}
+
+// newExplorer creates an explorer for the Inventory.
+func newExplorer(i *Inventory, policy MissingPolicy, summarize bool) *explorer {
+	return &explorer{inventory: i, missing: policy, summarize: summarize, limit: ExploreLimit}
+}
+
+// explore walks every outcome of the Template, starting from the supplied State.
+func (x *explorer) explore(t *Template, state *State, k func(o outcome) error) error {
+	vars := make(map[string]string)
+	captures := make(map[string]Capture)
+	if state != nil {
+		for name, val := range state.Vars {
+			vars[name] = val
+		}
+		for name, c := range state.Captures {
+			captures[name] = c
+		}
+	}
+
+	start := outcome{vars: vars, captures: captures, prob: 1.0}
+
+	return x.walk(t.nodes, 0, start, false, func(o outcome) error {
+		x.outcomes++
+		if x.outcomes > x.limit {
+			return ErrTooManyOutcomes
+		}
+
+		return k(o)
+	})
+}
+
+// walk explores the nodes in order, calling k with each outcome reached after the last node.
+func (x *explorer) walk(nodes []node, depth int, o outcome, inOption bool, k func(o outcome) error) error {
+	if len(nodes) == 0 {
+		return k(o)
+	}
+
+	rest := func(o outcome) error {
+		return x.walk(nodes[1:], depth, o, inOption, k)
+	}
+
+	switch n := nodes[0].(type) {
+	case *textNode:
+		o.text += n.text
+	case *varNode:
+		val := o.vars[n.name]
+		if val == "" {
+			val = n.raw
+		}
+		o.text += val
+	case *captureNode:
+		val, found := lookupCapture(o.captures, n.name, n.property)
+		if !found {
+			val = n.raw
+		}
+		o.text += val
+	case *refNode:
+		val, err := n.resolve(o.vars, o.captures)
+		if err != nil {
+			return err
+		}
+		o.text += val
+	case *selectorNode:
+		return x.selector(n, depth, o, inOption, rest)
+	case *altNode:
+		return x.alternatives(n, depth, o, inOption, rest)
+	case *ifNode:
+		return x.walk(n.branch(o.vars), depth, o, inOption, rest)
+	case *repeatNode:
+		return x.repeat(n, depth, o, inOption, rest)
+	}
+
+	return rest(o)
+}
+
+// selector explores every combination of option values for a selector node, then every Token
+// which could be picked for each resulting Selector.
+func (x *explorer) selector(n *selectorNode, depth int, o outcome, inOption bool, k func(o outcome) error) error {
+	return x.options(n, nil, depth, o, func(o outcome, values []string) error {
+		selector := newSelector(n.category)
+		for idx, opt := range n.options {
+			selector.addOption(opt.key, opt.op, values[idx])
+		}
+
+		return x.pick(n, selector, depth, o, inOption, k)
+	})
+}
+
+// alternatives explores each alternative of an alternation node.
+func (x *explorer) alternatives(n *altNode, depth int, o outcome, inOption bool, k func(o outcome) error) error {
+	for idx := range n.choices {
+		next := o
+		next.prob *= n.choices[idx].weight / n.total
+
+		if err := x.walk(n.choices[idx].nodes, depth, next, inOption, k); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// repeat explores each number of repetitions of a {repeat} block.
+func (x *explorer) repeat(n *repeatNode, depth int, o outcome, inOption bool, k func(o outcome) error) error {
+	// The outermost unique block tracks the Tokens picked within it, and stops when it ends
+	outer := n.unique && o.used == nil
+	done := k
+	if outer {
+		done = func(o outcome) error {
+			o.used = nil
+			return k(o)
+		}
+	}
+
+	for count := n.min; count <= n.max; count++ {
+		next := o
+		next.prob /= float64(n.max - n.min + 1)
+		if outer {
+			next.used = make(map[string]bool)
+		}
+
+		if err := x.iterate(n, 0, count, depth, next, inOption, done); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// iterate explores the repetitions of a {repeat} block from idx onwards.
+func (x *explorer) iterate(n *repeatNode, idx int, count int, depth int, o outcome, inOption bool, k func(o outcome) error) error {
+	if idx == count {
+		return k(o)
+	}
+
+	o.text += n.separator(idx, count)
+
+	return x.walk(n.body, depth, o, inOption, func(o outcome) error {
+		return x.iterate(n, idx+1, count, depth, o, inOption, k)
+	})
+}
+
+// options explores the values of the remaining options of a selector node.
+func (x *explorer) options(n *selectorNode, values []string, depth int, o outcome, k func(o outcome, values []string) error) error {
+	idx := len(values)
+	if idx == len(n.options) {
+		return k(o, values)
+	}
+
+	text := o.text
+	o.text = ""
+
+	return x.walk(n.options[idx].value, depth, o, true, func(v outcome) error {
+		next := append(values[:idx:idx], v.text)
+		v.text = text
+
+		return x.options(n, next, depth, v, k)
+	})
+}
+
+// pick explores each Token which the Selector could pick.
+func (x *explorer) pick(n *selectorNode, selector *Selector, depth int, o outcome, inOption bool, k func(o outcome) error) error {
+	var tokens []Token
+	var total float64
+	if o.used == nil {
+		tokens, total = x.inventory.getTokens(selector)
+	} else {
+		tokens, total = unusedTokens(x.inventory, selector, o.used)
+	}
+
+	if len(tokens) == 0 {
+		switch x.missing.Action {
+		case MissingLeave:
+			o.text += n.raw
+			return k(o)
+		case MissingEmpty:
+			return k(o)
+		case MissingFallback:
+			tokens, total = x.inventory.getTokens(newSelector(x.missing.Fallback))
+		}
+
+		if len(tokens) == 0 {
+			return &NoMatchError{Selector: selector, Category: selector.Category, Tag: n.raw, Position: n.pos}
+		}
+	}
+
+	if x.summarize && !inOption && n.capture == "" && o.used == nil && isolated(tokens) {
+		o.bits += distributionEntropy(tokens, total)
+		o.minBits -= math.Log2(maxRarity(tokens) / total)
+		o.text += tokens[0].Content
+
+		return k(o)
+	}
+
+	for idx := range tokens {
+		t := &tokens[idx]
+
+		next := o
+		next.prob *= t.Rarity / total
+		if t.ID != "" {
+			next.picked = append(o.picked[:len(o.picked):len(o.picked)], t.ID)
+		}
+		if o.used != nil {
+			next.used = make(map[string]bool, len(o.used)+1)
+			for id := range o.used {
+				next.used[id] = true
+			}
+			next.used[t.identity()] = true
+		}
+		if len(t.SetVars) > 0 {
+			next.vars = make(map[string]string, len(o.vars)+len(t.SetVars))
+			for name, val := range o.vars {
+				next.vars[name] = val
+			}
+			for name, val := range t.SetVars {
+				next.vars[name] = val
+			}
+		}
+
+		done := k
+		if n.capture != "" {
+			start := len(next.text)
+			done = func(o outcome) error {
+				captures := make(map[string]Capture, len(o.captures)+1)
+				for name, c := range o.captures {
+					captures[name] = c
+				}
+				captures[n.capture] = Capture{Token: *t, Text: o.text[start:]}
+				o.captures = captures
+
+				return k(o)
+			}
+		}
+
+		if err := x.content(t, depth+1, next, inOption, done); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// content explores the content of a picked Token.
+func (x *explorer) content(t *Token, depth int, o outcome, inOption bool, k func(o outcome) error) error {
+	content := t.compiled
+	if content == nil {
+		if !hasTags(t.Content) {
+			o.text += t.Content
+			return k(o)
+		}
+
+		var err error
+		content, err = Compile(t.Content)
+		if err != nil {
+			return errors.Wrapf(err, "parsing content of token %q in category %q", t.Content, t.Category)
+		}
+	}
+
+	if depth > int(RoundsMax) {
+		return &DepthError{Category: t.Category, Depth: depth}
+	}
+
+	return x.walk(content.nodes, depth, o, inOption, k)
+}
+
+// isolated checks if picking any of the Tokens can't affect the rest of a render, because none of
+// them set variables or contain further tags.
+func isolated(tokens []Token) bool {
+	for idx := range tokens {
+		if len(tokens[idx].SetVars) > 0 || hasTags(tokens[idx].Content) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// distributionEntropy calculates the Shannon entropy, in bits, of picking from the Tokens.
+func distributionEntropy(tokens []Token, total float64) float64 {
+	h := 0.0
+	for idx := range tokens {
+		p := tokens[idx].Rarity / total
+		h -= p * math.Log2(p)
+	}
+
+	return h
+}
+
+// maxRarity finds the largest Rarity among the Tokens.
+func maxRarity(tokens []Token) float64 {
+	m := 0.0
+	for idx := range tokens {
+		m = math.Max(m, tokens[idx].Rarity)
+	}
+
+	return m
+}
@@ -0,0 +1,82 @@
+/*
+ * Copyright 2020 zpxio (Jeff Sharpe)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package generator
+
+import (
+	"github.com/stretchr/testify/suite"
+	"testing"
+)
+
+type ExploreSuite struct {
+	suite.Suite
+}
+
+func TestExploreSuite(t *testing.T) {
+	suite.Run(t, new(ExploreSuite))
+}
+
+func (s *ExploreSuite) collect(instructions string, i *Inventory, summarize bool) map[string]float64 {
+	results := make(map[string]float64)
+
+	x := newExplorer(i, FailOnMissing, summarize)
+	err := x.explore(MustCompile(instructions), nil, func(o outcome) error {
+		results[o.text] += o.prob
+		return nil
+	})
+	s.Require().NoError(err)
+
+	return results
+}
+
+func (s *ExploreSuite) TestExplore_All() {
+	i := BuildSampleInventory()
+
+	results := s.collect("A [Animal:type=[AnimalType]]", i, false)
+
+	s.Len(results, 4)
+	s.InDelta(3.0/7.2*0.5, results["A Aardvark"], 1e-9)
+	s.InDelta(3.0/7.2*0.5, results["A Capybara"], 1e-9)
+	s.InDelta(3.0/7.2, results["A Boomalope"], 1e-9)
+	s.InDelta(1.2/7.2, results["A Cladoselache"], 1e-9)
+}
+
+func (s *ExploreSuite) TestExplore_Summarized() {
+	i := BuildSampleInventory()
+
+	results := s.collect("A [Description] [Animal]", i, true)
+
+	s.Equal(map[string]float64{"A Angry Aardvark": 1.0}, results)
+}
+
+func (s *ExploreSuite) TestExplore_OptionsNeverSummarized() {
+	i := BuildSampleInventory()
+
+	results := s.collect("[Animal:type=[AnimalType]]", i, true)
+
+	s.Len(results, 3)
+	s.InDelta(1.2/7.2, results["Cladoselache"], 1e-9)
+}
+
+func (s *ExploreSuite) TestExplore_Vars() {
+	i := BuildSampleInventory()
+	i.AddToken("Pet", "dog", 1.0, Properties{}).OnRenderSet("sound", "woof")
+	i.AddToken("Pet", "cat", 1.0, Properties{}).OnRenderSet("sound", "meow")
+
+	results := s.collect("The [Pet] says [$sound]", i, true)
+
+	s.Equal(map[string]float64{"The dog says woof": 0.5, "The cat says meow": 0.5}, results)
+}
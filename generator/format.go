@@ -0,0 +1,470 @@
+/*
+ * Copyright 2020 zpxio (Jeff Sharpe)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package generator
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/BurntSushi/toml"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// Format identifies the file format of an inventory.
+type Format int
+
+const (
+	// FormatAuto detects the format from the file extension, defaulting to YAML.
+	FormatAuto Format = iota
+	// FormatYAML is a YAML list of Token definitions, or a manifest.
+	FormatYAML
+	// FormatJSON is a JSON array of Token definitions, or a manifest.
+	FormatJSON
+	// FormatTOML is a TOML manifest, with a "tokens" array of tables holding Token definitions.
+	FormatTOML
+	// FormatCSV is a table with a header row naming the columns. The id, category, content and rarity
+	// columns map to the Token fields, while "prop.<name>" and "set.<name>" columns map to Properties
+	// and SetVars. Empty cells are ignored.
+	FormatCSV
+)
+
+// String returns the name of the Format.
+func (f Format) String() string {
+	switch f {
+	case FormatAuto:
+		return "auto"
+	case FormatYAML:
+		return "yaml"
+	case FormatJSON:
+		return "json"
+	case FormatTOML:
+		return "toml"
+	case FormatCSV:
+		return "csv"
+	}
+
+	return "unknown"
+}
+
+// ParseFormat finds the Format with the given name.
+func ParseFormat(name string) (Format, error) {
+	switch strings.ToLower(name) {
+	case "", "auto":
+		return FormatAuto, nil
+	case "yaml", "yml":
+		return FormatYAML, nil
+	case "json":
+		return FormatJSON, nil
+	case "toml":
+		return FormatTOML, nil
+	case "csv":
+		return FormatCSV, nil
+	}
+
+	return FormatAuto, fmt.Errorf("unknown inventory format: %q", name)
+}
+
+// FormatForPath detects the Format of a file from its extension. Files with unrecognized extensions
+// are assumed to be YAML.
+func FormatForPath(path string) Format {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return FormatJSON
+	case ".toml":
+		return FormatTOML
+	case ".csv":
+		return FormatCSV
+	}
+
+	return FormatYAML
+}
+
+// document holds the contents of an inventory file. Plain inventories only contain Token entries,
+// while manifests are maps which may hold other settings alongside a "tokens" list. The settings
+// are held in the generic form produced by decoding, and are nil for plain inventories.
+type document struct {
+	entries  []entry
+	settings map[string]interface{}
+}
+
+// readDocument parses inventory data in the given Format.
+func readDocument(data []byte, format Format) (*document, error) {
+	switch format {
+	case FormatJSON:
+		return readJSONDocument(data)
+	case FormatTOML:
+		return readTOMLDocument(data)
+	case FormatCSV:
+		entries, err := readCSVEntries(data)
+		if err != nil {
+			return nil, err
+		}
+		return &document{entries: entries}, nil
+	}
+
+	return readYAMLDocument(data)
+}
+
+// readYAMLDocument parses YAML data containing either a list of Token definitions or a manifest.
+func readYAMLDocument(data []byte) (*document, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+
+	// Empty documents contain no entries
+	if len(doc.Content) == 0 {
+		return &document{}, nil
+	}
+
+	root := doc.Content[0]
+	if root.Kind == yaml.SequenceNode {
+		entries, err := readYAMLEntries(root)
+		return &document{entries: entries}, err
+	}
+	if root.Kind != yaml.MappingNode {
+		return nil, errors.Errorf("line %d: expected a list of tokens or a manifest", root.Line)
+	}
+
+	d := &document{settings: make(map[string]interface{})}
+	for n := 0; n+1 < len(root.Content); n += 2 {
+		key, value := root.Content[n], root.Content[n+1]
+		if key.Value == manifestTokens {
+			if value.Kind != yaml.SequenceNode {
+				return nil, errors.Errorf("line %d: tokens must be a list of tokens", value.Line)
+			}
+			entries, err := readYAMLEntries(value)
+			if err != nil {
+				return nil, err
+			}
+			d.entries = entries
+			continue
+		}
+
+		var v interface{}
+		if err := value.Decode(&v); err != nil {
+			return nil, errors.Wrapf(err, "line %d", value.Line)
+		}
+		d.settings[key.Value] = v
+	}
+
+	return d, nil
+}
+
+// readYAMLEntries reads the Token definitions in a YAML sequence.
+func readYAMLEntries(seq *yaml.Node) ([]entry, error) {
+	entries := make([]entry, 0, len(seq.Content))
+	for idx, item := range seq.Content {
+		e := entry{
+			index:    idx,
+			pos:      position{line: item.Line, column: item.Column},
+			fieldPos: make(map[string]position),
+		}
+
+		if item.Kind == yaml.MappingNode {
+			e.fields = make(map[string]interface{})
+			if err := item.Decode(&e.fields); err != nil {
+				return nil, errors.Wrapf(err, "line %d", item.Line)
+			}
+			for n := 0; n+1 < len(item.Content); n += 2 {
+				key := item.Content[n]
+				e.fieldPos[key.Value] = position{line: key.Line, column: key.Column}
+			}
+		}
+
+		entries = append(entries, e)
+	}
+
+	return entries, nil
+}
+
+// offsetPosition converts a byte offset within data to a line and column.
+func offsetPosition(data []byte, offset int64) position {
+	before := data[:offset]
+
+	return position{
+		line:   1 + bytes.Count(before, []byte("\n")),
+		column: int(offset) - bytes.LastIndexByte(before, '\n'),
+	}
+}
+
+// readJSONDocument parses JSON data containing either an array of Token definitions or a manifest.
+func readJSONDocument(data []byte) (*document, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	start, err := dec.Token()
+	if err == io.EOF {
+		return &document{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	d := &document{}
+	switch start {
+	case json.Delim('['):
+		if d.entries, err = readJSONEntries(dec, data); err != nil {
+			return nil, err
+		}
+	case json.Delim('{'):
+		d.settings = make(map[string]interface{})
+		for dec.More() {
+			key, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			name, _ := key.(string)
+
+			if name == manifestTokens {
+				if t, err := dec.Token(); err != nil {
+					return nil, err
+				} else if t != json.Delim('[') {
+					return nil, errors.New("tokens must be an array of tokens")
+				}
+				if d.entries, err = readJSONEntries(dec, data); err != nil {
+					return nil, err
+				}
+				continue
+			}
+
+			var v interface{}
+			if err := dec.Decode(&v); err != nil {
+				return nil, err
+			}
+			d.settings[name] = v
+		}
+		if _, err := dec.Token(); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, errors.New("expected an array of tokens or a manifest")
+	}
+
+	return d, nil
+}
+
+// readJSONEntries reads the Token definitions in a JSON array, after its opening bracket has been
+// read. The closing bracket is consumed.
+func readJSONEntries(dec *json.Decoder, data []byte) ([]entry, error) {
+	var entries []entry
+	for dec.More() {
+		// Skip to the start of the value, so that the position points at it
+		offset := dec.InputOffset()
+		for offset < int64(len(data)) && bytes.IndexByte([]byte(" \t\r\n,"), data[offset]) >= 0 {
+			offset++
+		}
+
+		var value interface{}
+		if err := dec.Decode(&value); err != nil {
+			return nil, err
+		}
+
+		e := entry{index: len(entries), pos: offsetPosition(data, offset)}
+		if fields, ok := value.(map[string]interface{}); ok {
+			e.fields = fields
+		}
+		entries = append(entries, e)
+	}
+
+	if _, err := dec.Token(); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// readTOMLDocument parses TOML data. Since TOML documents are always tables, Token definitions are
+// held in a "tokens" array of tables, alongside any other manifest settings.
+func readTOMLDocument(data []byte) (*document, error) {
+	var doc map[string]interface{}
+	if _, err := toml.Decode(string(data), &doc); err != nil {
+		return nil, err
+	}
+
+	var tables []map[string]interface{}
+	switch x := doc[manifestTokens].(type) {
+	case nil:
+	case []map[string]interface{}:
+		tables = x
+	case []interface{}:
+		// An empty array has no tables
+		if len(x) > 0 {
+			return nil, errors.New("tokens must be an array of tables")
+		}
+	default:
+		return nil, errors.New("tokens must be an array of tables")
+	}
+	delete(doc, manifestTokens)
+
+	d := &document{}
+	if len(doc) > 0 {
+		d.settings = doc
+	}
+
+	positions, fieldPositions := tomlTablePositions(data)
+	for idx, fields := range tables {
+		e := entry{index: idx, fields: fields}
+		// Headers the scan doesn't recognize, such as quoted keys, leave the entries without positions
+		if len(positions) == len(tables) {
+			e.pos, e.fieldPos = positions[idx], fieldPositions[idx]
+		}
+		d.entries = append(d.entries, e)
+	}
+
+	return d, nil
+}
+
+// tomlTablePositions finds the position of each [[tokens]] table header in TOML data, along with
+// the positions of the keys set within each table. The TOML decoder doesn't report positions, so
+// the lines are scanned directly, skipping the contents of multi-line strings.
+func tomlTablePositions(data []byte) ([]position, []map[string]position) {
+	var positions []position
+	var fieldPositions []map[string]position
+	var fields map[string]position
+	multiline := ""
+
+	for n, line := range strings.Split(string(data), "\n") {
+		trimmed := strings.TrimSpace(line)
+		column := 1 + len(line) - len(strings.TrimLeft(line, " \t"))
+
+		if multiline != "" {
+			if strings.Count(trimmed, multiline)%2 == 1 {
+				multiline = ""
+			}
+			continue
+		}
+
+		switch {
+		case strings.HasPrefix(trimmed, "[["):
+			name := strings.TrimSpace(strings.TrimPrefix(strings.SplitN(trimmed, "]]", 2)[0], "[["))
+			fields = nil
+			if name == manifestTokens {
+				fields = make(map[string]position)
+				positions = append(positions, position{line: n + 1, column: column})
+				fieldPositions = append(fieldPositions, fields)
+			}
+		case strings.HasPrefix(trimmed, "["):
+			// Sub-tables of a Token, such as [tokens.properties], set one of its fields
+			name := strings.TrimSpace(strings.TrimPrefix(strings.SplitN(trimmed, "]", 2)[0], "["))
+			if field := strings.TrimPrefix(name, manifestTokens+"."); fields != nil && field != name {
+				if _, found := fields[field]; !found {
+					fields[field] = position{line: n + 1, column: column}
+				}
+			}
+			fields = nil
+		case trimmed != "" && trimmed[0] != '#' && fields != nil:
+			if eq := strings.IndexByte(trimmed, '='); eq > 0 {
+				key := strings.Trim(strings.TrimSpace(trimmed[:eq]), `"'`)
+				key = strings.SplitN(key, ".", 2)[0]
+				if _, found := fields[key]; !found {
+					fields[key] = position{line: n + 1, column: column}
+				}
+			}
+		}
+
+		for _, quotes := range []string{`"""`, "'''"} {
+			if strings.Count(trimmed, quotes)%2 == 1 {
+				multiline = quotes
+			}
+		}
+	}
+
+	return positions, fieldPositions
+}
+
+// CSV column prefixes for Properties and SetVars
+const (
+	csvPropertyPrefix = "prop."
+	csvSetVarPrefix   = "set."
+)
+
+// readCSVEntries parses CSV data with a header row. A leading byte order mark, which spreadsheets
+// often write, is ignored.
+func readCSVEntries(data []byte) ([]entry, error) {
+	data = bytes.TrimPrefix(data, []byte("\ufeff"))
+
+	r := csv.NewReader(bytes.NewReader(data))
+	r.FieldsPerRecord = -1
+
+	header, err := r.Read()
+	if err == io.EOF {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	for n := range header {
+		header[n] = strings.TrimSpace(header[n])
+	}
+
+	var entries []entry
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		line, column := r.FieldPos(0)
+		e := entry{
+			index:    len(entries),
+			pos:      position{line: line, column: column},
+			fields:   make(map[string]interface{}),
+			fieldPos: make(map[string]position),
+		}
+		properties := make(map[string]interface{})
+		setVars := make(map[string]interface{})
+
+		for n, value := range record {
+			if value == "" {
+				continue
+			}
+
+			name := fmt.Sprintf("column %d", n+1)
+			if n < len(header) {
+				name = header[n]
+			}
+
+			switch {
+			case strings.HasPrefix(name, csvPropertyPrefix):
+				properties[strings.TrimPrefix(name, csvPropertyPrefix)] = value
+			case strings.HasPrefix(name, csvSetVarPrefix):
+				setVars[strings.TrimPrefix(name, csvSetVarPrefix)] = value
+			default:
+				e.fields[name] = value
+			}
+
+			line, column := r.FieldPos(n)
+			e.fieldPos[name] = position{line: line, column: column}
+		}
+
+		if len(properties) > 0 {
+			e.fields["properties"] = properties
+		}
+		if len(setVars) > 0 {
+			e.fields["setvars"] = setVars
+		}
+		entries = append(entries, e)
+	}
+
+	return entries, nil
+}
@@ -0,0 +1,216 @@
+/*
+ * Copyright 2020 zpxio (Jeff Sharpe)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package generator
+
+import (
+	"github.com/stretchr/testify/suite"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type FormatSuite struct {
+	suite.Suite
+}
+
+func TestFormatSuite(t *testing.T) {
+	suite.Run(t, new(FormatSuite))
+}
+
+func (s *FormatSuite) TestParseFormat() {
+	for name, expected := range map[string]Format{"": FormatAuto, "auto": FormatAuto, "YAML": FormatYAML, "yml": FormatYAML, "json": FormatJSON, "toml": FormatTOML, "csv": FormatCSV} {
+		f, err := ParseFormat(name)
+		s.NoError(err)
+		s.Equal(expected, f, name)
+	}
+
+	_, err := ParseFormat("xml")
+	s.Error(err)
+}
+
+func (s *FormatSuite) TestFormatString() {
+	s.Equal("yaml", FormatYAML.String())
+	s.Equal("csv", FormatCSV.String())
+	s.Equal("unknown", Format(42).String())
+}
+
+func (s *FormatSuite) TestFormatForPath() {
+	s.Equal(FormatYAML, FormatForPath("a/b.yml"))
+	s.Equal(FormatYAML, FormatForPath("a/b.yaml"))
+	s.Equal(FormatYAML, FormatForPath("a/b"))
+	s.Equal(FormatJSON, FormatForPath("a/b.JSON"))
+	s.Equal(FormatTOML, FormatForPath("b.toml"))
+	s.Equal(FormatCSV, FormatForPath("b.csv"))
+}
+
+func (s *FormatSuite) TestLoad_AllFormatsMatch() {
+	expected := CreateInventory()
+	s.Require().NoError(expected.Load(filepath.Join(DataDir(), "inv_animals.yml")))
+
+	for _, name := range []string{"inv_animals.json", "inv_animals.toml", "inv_animals.csv"} {
+		i := CreateInventory()
+		report, err := i.LoadWithReport(filepath.Join(DataDir(), name), LoadOptions{Strict: true})
+
+		s.Require().NoError(err, name)
+		s.Equal(11, report.Loaded, name)
+		s.Equal(expected.dictionary, i.dictionary, name)
+		s.Equal(expected.selectRange, i.selectRange, name)
+	}
+}
+
+func (s *FormatSuite) TestLoad_ExplicitFormat() {
+	i := CreateInventory()
+
+	_, err := i.LoadWithReport(filepath.Join(DataDir(), "inv_animals.json"), LoadOptions{Format: FormatYAML})
+
+	// JSON is also valid YAML
+	s.NoError(err)
+	s.Len(i.dictionary["Animal"], 4)
+
+	_, err = i.LoadWithReport(filepath.Join(DataDir(), "inv_animals.yml"), LoadOptions{Format: FormatJSON})
+	s.Error(err)
+}
+
+func (s *FormatSuite) TestLoad_JSONIssues() {
+	testFile := filepath.Join(DataDir(), "issues.json")
+	i := CreateInventory()
+
+	report, err := i.LoadWithReport(testFile, LoadOptions{})
+
+	s.NoError(err)
+	s.Equal(2, report.Loaded)
+	s.Require().Len(report.Issues, 2)
+	s.Equal(LoadIssue{File: testFile, Line: 3, Column: 3, Entry: 1, Kind: IssueMissingContent, Field: "content", Message: "missing content", Rejected: true}, report.Issues[0])
+	s.Equal(LoadIssue{File: testFile, Line: 4, Column: 3, Entry: 2, Kind: IssueInvalidValue, Message: "entry is not a token definition", Rejected: true}, report.Issues[1])
+
+	capybara := i.dictionary["Animal"][1]
+	s.Equal(1.0, capybara.Rarity)
+	s.Equal("4", capybara.Properties["legs"])
+	s.Equal("squeak", capybara.SetVars["sound"])
+	s.Equal(1.5, i.dictionary["Animal"][0].Rarity)
+}
+
+func (s *FormatSuite) TestLoad_TOMLIssues() {
+	testFile := filepath.Join(DataDir(), "issues.toml")
+	i := CreateInventory()
+
+	report, err := i.LoadWithReport(testFile, LoadOptions{})
+
+	s.NoError(err)
+	s.Equal(2, report.Loaded)
+	s.Require().Len(report.Issues, 4)
+	s.Equal(LoadIssue{File: testFile, Line: 9, Column: 1, Entry: 1, Kind: IssueMissingContent, Field: "content", Message: "missing content", Rejected: true}, report.Issues[0])
+	s.Equal(IssueUnknownField, report.Issues[1].Kind)
+	s.Equal(11, report.Issues[1].Line)
+	s.Equal(LoadIssue{File: testFile, Line: 19, Column: 3, Entry: 2, Kind: IssueInvalidRarity, Field: "rarity", Message: "rarity abc is not a positive number; using 1.0"}, report.Issues[2])
+	s.Equal(LoadIssue{File: testFile, Line: 20, Column: 3, Entry: 2, Kind: IssueUnknownField, Field: "colour", Message: `unknown field "colour"`}, report.Issues[3])
+
+	s.Equal("mammal", i.dictionary["Animal"][0].Properties["type"])
+}
+
+func (s *FormatSuite) TestLoad_CSVIssues() {
+	testFile := filepath.Join(DataDir(), "issues.csv")
+	i := CreateInventory()
+
+	report, err := i.LoadWithReport(testFile, LoadOptions{})
+
+	s.NoError(err)
+	s.Equal(2, report.Loaded)
+
+	s.Require().Len(report.Issues, 4)
+	s.Equal(LoadIssue{File: testFile, Line: 3, Column: 1, Entry: 1, Kind: IssueMissingContent, Field: "content", Message: "missing content", Rejected: true}, report.Issues[0])
+	s.Equal(IssueMissingCategory, report.Issues[1].Kind)
+	s.Equal(4, report.Issues[1].Line)
+	s.Equal(LoadIssue{File: testFile, Line: 6, Column: 17, Entry: 3, Kind: IssueInvalidRarity, Field: "rarity", Message: "rarity abc is not a positive number; using 1.0"}, report.Issues[2])
+	s.Equal(LoadIssue{File: testFile, Line: 6, Column: 29, Entry: 3, Kind: IssueUnknownField, Field: "colour", Message: `unknown field "colour"`}, report.Issues[3])
+
+	aardvark := i.dictionary["Animal"][0]
+	s.Equal(Properties{"type": "mammal"}, Properties(aardvark.Properties))
+	s.Equal("snuffle", aardvark.SetVars["sound"])
+}
+
+func (s *FormatSuite) TestLoad_CSVByteOrderMark() {
+	i := CreateInventory()
+
+	report, err := i.LoadReaderWithReport(strings.NewReader("\ufeffcategory,content\nAnimal,Okapi\n"), "x.csv", LoadOptions{})
+
+	s.NoError(err)
+	s.Equal(1, report.Loaded)
+	s.Empty(report.Issues)
+	s.Equal("Okapi", i.dictionary["Animal"][0].Content)
+
+	i = CreateInventory()
+	report, err = i.LoadReaderWithReport(strings.NewReader("\ufeff\"category\",content\nAnimal,Okapi\n"), "x.csv", LoadOptions{})
+
+	s.NoError(err)
+	s.Equal(1, report.Loaded)
+}
+
+func (s *FormatSuite) TestReadDocument_Errors() {
+	_, err := readDocument([]byte(`{"tokens": {}}`), FormatJSON)
+	s.Error(err)
+
+	_, err = readDocument([]byte(`"tokens"`), FormatJSON)
+	s.Error(err)
+
+	_, err = readDocument([]byte("tokens: 4\n"), FormatYAML)
+	s.Error(err)
+
+	_, err = readDocument([]byte("just text\n"), FormatYAML)
+	s.Error(err)
+
+	_, err = readDocument([]byte(`[{"category": "A"`), FormatJSON)
+	s.Error(err)
+
+	_, err = readDocument([]byte("tokens = 4\n"), FormatTOML)
+	s.Error(err)
+
+	_, err = readDocument([]byte("a,\"b\n"), FormatCSV)
+	s.Error(err)
+
+	for _, f := range []Format{FormatYAML, FormatJSON, FormatTOML, FormatCSV} {
+		doc, err := readDocument([]byte{}, f)
+		s.NoError(err, f.String())
+		s.Empty(doc.entries, f.String())
+		s.Nil(doc.settings, f.String())
+	}
+}
+
+func (s *FormatSuite) TestReadDocument_Manifest() {
+	yamlDoc := "include: [base.yml]\nmode: replace\ntokens:\n  - category: Animal\n    content: Okapi\n"
+	jsonDoc := `{"include": ["base.yml"], "mode": "replace", "tokens": [{"category": "Animal", "content": "Okapi"}]}`
+	tomlDoc := "include = [\"base.yml\"]\nmode = \"replace\"\n[[tokens]]\ncategory = \"Animal\"\ncontent = \"Okapi\"\n"
+
+	for f, data := range map[Format]string{FormatYAML: yamlDoc, FormatJSON: jsonDoc, FormatTOML: tomlDoc} {
+		doc, err := readDocument([]byte(data), f)
+
+		s.Require().NoError(err, f.String())
+		s.Require().Len(doc.entries, 1, f.String())
+		s.Equal("Okapi", doc.entries[0].fields["content"], f.String())
+		s.Equal("replace", doc.settings["mode"], f.String())
+		s.Equal([]interface{}{"base.yml"}, doc.settings["include"], f.String())
+		s.NotContains(doc.settings, "tokens", f.String())
+	}
+}
+
+func (s *FormatSuite) TestReadDocument_ManifestPositions() {
+	doc, err := readDocument([]byte("{\n  \"mode\": \"append\",\n  \"tokens\": [\n    {\"category\": \"A\"}\n  ]\n}\n"), FormatJSON)
+
+	s.Require().NoError(err)
+	s.Require().Len(doc.entries, 1)
+	s.Equal(position{line: 4, column: 5}, doc.entries[0].pos)
+}
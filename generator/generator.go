@@ -16,31 +16,83 @@
 
 // Package generator contains functionality to generate randomized, structured text based on a
 // mixture of randomized selection and configured selections.
+//
+// # Concurrency
+//
+// A configured Generator may be run from many goroutines at once. Configuration methods such as
+// UseRandomSource and UseMissingPolicy must be called before the Generator is shared, except for
+// UseInventory, which swaps the Inventory atomically. A Watcher uses it to reload inventories while
+// Generators are in use. Each run must be given its own State, since rendering sets variables on it.
+//
+// Inventories are guarded internally, so picking from an Inventory while Tokens are being added is
+// safe, although the output then depends on timing. For predictable output under concurrent load,
+// build the Inventory fully and then Freeze it or use a Snapshot.
+//
+// The RandomSources in package rng are all safe for concurrent use, but a single shared source
+// serializes the goroutines drawing from it, and makes seeded output depend on scheduling. Use
+// UseRandomFactory to give every run its own stream instead.
 package generator
 
-import "github.com/zpxio/octogen/rng"
+import (
+	"github.com/apex/log"
+	"github.com/zpxio/octogen/rng"
+	"sync/atomic"
+)
 
 // Generator is a reusable text generator which potentially produces different output each time
 // it is used.
 type Generator struct {
-	instructions string
-	inventory    *Inventory
-	rng          rng.RandomSource
+	template  *Template
+	err       error
+	inventory atomic.Value
+	rng       rng.RandomSource
+	factory   func() rng.RandomSource
+	missing   MissingPolicy
+	secure    bool
 }
 
 // CreateGenerator creates a reusable text generator based on the instructions provided and the
 // given inventory. Each time the generator is used, it can potentially produce different output.
+// If the instructions can't be compiled, every run of the generator fails with the *SyntaxError;
+// use CompileGenerator to detect this when the generator is created. Like Render, the generator
+// leaves selectors which don't match any Token in its output, unless UseMissingPolicy is called.
 func CreateGenerator(instructions string, inventory *Inventory) *Generator {
+	t, err := Compile(instructions)
+	if err != nil {
+		g := CreateTemplateGenerator(&Template{source: instructions}, inventory)
+		g.err = err
+
+		return g
+	}
+
+	return CreateTemplateGenerator(t, inventory)
+}
+
+// CompileGenerator compiles the instructions and creates a reusable text generator from them. An error
+// is returned if the instructions can't be compiled.
+func CompileGenerator(instructions string, inventory *Inventory) (*Generator, error) {
+	t, err := Compile(instructions)
+	if err != nil {
+		return nil, err
+	}
+
+	return CreateTemplateGenerator(t, inventory), nil
+}
+
+// CreateTemplateGenerator creates a reusable text generator from a compiled Template and the given
+// inventory.
+func CreateTemplateGenerator(t *Template, inventory *Inventory) *Generator {
 	g := &Generator{
-		instructions: instructions,
-		inventory:    inventory,
-		rng:          rng.UseSystem(),
+		template: t,
+		rng:      rng.UseSystem(),
+		missing:  LeaveMissing,
 	}
+	g.UseInventory(inventory)
 
 	return g
 }
 
-// Run executes the generator with a new empty State.
+// Run executes the generator with a new empty State. If rendering fails, an empty string is returned.
 func (g *Generator) Run() string {
 	state := CreateState()
 
@@ -48,14 +100,163 @@ func (g *Generator) Run() string {
 }
 
 // RunWithState executes the generator with the supplied State. This function is used to execute Generators
-// with pre-defined state for instruction sets that require variable substitution.
+// with pre-defined state for instruction sets that require variable substitution. If rendering fails, the
+// error is logged and an empty string is returned; use TryRunWithState to receive the error.
 func (g *Generator) RunWithState(state *State) string {
-	result := Render(g.instructions, g.inventory, state, g.rng)
+	result, err := g.TryRunWithState(state)
+	if err != nil {
+		log.WithError(err).Warn("Failed to render instructions")
+	}
 
 	return result
 }
 
-// UseRandomSource assigns a RandomSource to use when picking tokens.
+// TryRun executes the generator with a new empty State, returning any error encountered while rendering.
+func (g *Generator) TryRun() (string, error) {
+	return g.TryRunWithState(CreateState())
+}
+
+// TryRunWithState executes the generator with the supplied State, returning any error encountered while
+// rendering. Selectors which don't match any Token are handled according to the generator's MissingPolicy.
+func (g *Generator) TryRunWithState(state *State) (string, error) {
+	text, _, err := g.render(state, g.source())
+
+	return text, err
+}
+
+// RunRecorded executes the generator with the supplied State while recording every value drawn from
+// its RandomSource, and the IDs of the Tokens picked. The Recording can be replayed with rng.UseReplay
+// to reproduce the result exactly. A Result is returned even if rendering fails, so that the values
+// drawn can be examined.
+func (g *Generator) RunRecorded(state *State) (*Result, error) {
+	recorder := rng.UseRecorder(g.source())
+
+	text, ids, err := g.render(state, recorder)
+
+	return &Result{Text: text, IDs: ids, Recording: recorder.Recording()}, err
+}
+
+// source retrieves the RandomSource to use for a single run.
+func (g *Generator) source() rng.RandomSource {
+	if g.factory != nil {
+		return g.factory()
+	}
+
+	return g.rng
+}
+
+// render executes the generator's Template using the given RandomSource, returning the output and
+// the IDs of the Tokens picked.
+func (g *Generator) render(state *State, source rng.RandomSource) (string, []string, error) {
+	if g.err != nil {
+		return "", nil, g.err
+	}
+
+	if g.secure && !rng.IsSecure(source) {
+		return "", nil, ErrInsecureSource
+	}
+
+	result, ids, err := g.template.execute(g.Inventory(), state, source, g.missing)
+	if err != nil {
+		return "", ids, err
+	}
+
+	if err := rng.Err(source); err != nil {
+		return "", ids, err
+	}
+
+	return result, ids, nil
+}
+
+// UseInventory assigns the Inventory that Tokens are picked from. Unlike the other configuration
+// methods, it may be called while the Generator is running: runs which have already started finish
+// using the Inventory they started with, and later runs use the new one.
+func (g *Generator) UseInventory(inventory *Inventory) {
+	g.inventory.Store(inventory)
+}
+
+// Inventory retrieves the Inventory that Tokens are currently picked from.
+func (g *Generator) Inventory() *Inventory {
+	i, _ := g.inventory.Load().(*Inventory)
+
+	return i
+}
+
+// Template retrieves the compiled Template used by the generator.
+func (g *Generator) Template() *Template {
+	return g.template
+}
+
+// Result holds the output of a Generator run along with details of how it was produced.
+type Result struct {
+	// Text is the generated output.
+	Text string
+	// IDs lists the IDs of the Tokens picked during the run, in the order they were picked. Tokens
+	// without an ID aren't listed.
+	IDs []string
+	// Recording holds every value drawn from the RandomSource during the run.
+	Recording *rng.Recording
+}
+
+// UseRandomSource assigns a RandomSource to use when picking tokens. The source is shared by every
+// run, replacing any factory assigned with UseRandomFactory.
 func (g *Generator) UseRandomSource(rng rng.RandomSource) {
 	g.rng = rng
+	g.factory = nil
+}
+
+// UseRandomFactory assigns a function which creates a new RandomSource for every run, so that runs in
+// different goroutines don't share a random stream. The factory must be safe for concurrent use.
+func (g *Generator) UseRandomFactory(factory func() rng.RandomSource) {
+	g.factory = factory
+}
+
+// UseMissingPolicy assigns the MissingPolicy used when a Selector doesn't match any Token. Generators
+// use LeaveMissing unless configured otherwise, as Render does; use FailOnMissing to have TryRun
+// return a *NoMatchError instead.
+func (g *Generator) UseMissingPolicy(policy MissingPolicy) {
+	g.missing = policy
+}
+
+// RequireSecure requires the generator to use a cryptographically secure RandomSource. If the current
+// source isn't secure, it is replaced with rng.SecureRand. If a random factory is in use, it must
+// create secure sources. Once required, any run using a source that isn't secure fails with
+// ErrInsecureSource.
+func (g *Generator) RequireSecure() {
+	g.secure = true
+
+	if g.factory == nil && !rng.IsSecure(g.rng) {
+		g.rng = rng.UseSecure()
+	}
+}
+
+// Entropy estimates the Entropy of the generator's output when run with the supplied State. A nil
+// State is treated as an empty State.
+func (g *Generator) Entropy(state *State) (Entropy, error) {
+	if g.err != nil {
+		return Entropy{}, g.err
+	}
+
+	return EstimateEntropy(g.template, g.Inventory(), state, g.missing)
+}
+
+// Stats calculates the distribution of the generator's output when run with the supplied State,
+// listing up to top outputs at each end of the distribution. A nil State is treated as an empty
+// State.
+func (g *Generator) Stats(state *State, top int) (*TemplateStats, error) {
+	if g.err != nil {
+		return nil, g.err
+	}
+
+	return AnalyzeTemplate(g.template, g.Inventory(), state, g.missing, top)
+}
+
+// Enumerate produces every possible result of running the generator with the supplied State, up to
+// the limit, as described by the Enumerate function. A nil State is treated as an empty State.
+func (g *Generator) Enumerate(state *State, limit int, fn func(e Enumeration) error) (bool, error) {
+	if g.err != nil {
+		return false, g.err
+	}
+
+	return Enumerate(g.template, g.Inventory(), state, g.missing, limit, fn)
 }
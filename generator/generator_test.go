@@ -17,8 +17,10 @@
 package generator
 
 import (
+	"errors"
 	"github.com/stretchr/testify/suite"
 	"github.com/zpxio/octogen/rng"
+	"sync"
 	"testing"
 )
 
@@ -36,8 +38,48 @@ func (s *GeneratorSuite) TestCreateGenerator() {
 	g := CreateGenerator(t, i)
 
 	s.NotNil(g)
-	s.Equal(t, g.instructions)
-	s.Same(i, g.inventory)
+	s.Equal(t, g.Template().String())
+	s.NoError(g.err)
+	s.Same(i, g.Inventory())
+}
+
+func (s *GeneratorSuite) TestCreateGenerator_SyntaxError() {
+	i := BuildSampleInventory()
+	g := CreateGenerator("Test [Animal", i)
+
+	s.NotNil(g)
+	s.Equal("Test [Animal", g.Template().String())
+
+	_, err := g.TryRun()
+	s.IsType(&SyntaxError{}, err)
+}
+
+func (s *GeneratorSuite) TestCompileGenerator() {
+	i := BuildSampleInventory()
+	g, err := CompileGenerator("Test [Animal]", i)
+
+	s.NoError(err)
+	s.Require().NotNil(g)
+	g.UseRandomSource(rng.UseStatic(0))
+	s.Equal("Test Aardvark", g.Run())
+}
+
+func (s *GeneratorSuite) TestCompileGenerator_SyntaxError() {
+	i := BuildSampleInventory()
+	g, err := CompileGenerator("Test [Animal:type=]", i)
+
+	s.Nil(g)
+	s.IsType(&SyntaxError{}, err)
+}
+
+func (s *GeneratorSuite) TestCreateTemplateGenerator() {
+	i := BuildSampleInventory()
+	t := MustCompile("Test [Description] [Animal]")
+	g := CreateTemplateGenerator(t, i)
+	g.UseRandomSource(rng.UseStatic(0))
+
+	s.Same(t, g.Template())
+	s.Equal("Test Angry Aardvark", g.Run())
 }
 func (s *GeneratorSuite) TestUseRandomSource() {
 	i := BuildSampleInventory()
@@ -97,3 +139,190 @@ func (s *GeneratorSuite) TestRunWithState() {
 
 	s.Equal("Test Aardvark", result)
 }
+
+func (s *GeneratorSuite) TestTryRun_NoMatch() {
+	i := BuildSampleInventory()
+	g := CreateGenerator("Test [Animal:type=bird]", i)
+	g.UseRandomSource(rng.UseStatic(0))
+	g.UseMissingPolicy(FailOnMissing)
+
+	result, err := g.TryRun()
+
+	s.Error(err)
+	s.IsType(&NoMatchError{}, err)
+	s.Empty(result)
+	s.Empty(g.Run())
+}
+
+func (s *GeneratorSuite) TestRun_MissingDefault() {
+	i := BuildSampleInventory()
+	g := CreateGenerator("Test [Animal:type=bird]", i)
+	g.UseRandomSource(rng.UseStatic(0))
+
+	result, err := g.TryRun()
+
+	s.NoError(err)
+	s.Equal("Test [Animal:type=bird]", result)
+	s.Equal(result, g.Run())
+	s.Equal(result, Render("Test [Animal:type=bird]", i, CreateState(), rng.UseStatic(0)))
+}
+
+func (s *GeneratorSuite) TestUseMissingPolicy() {
+	i := BuildSampleInventory()
+	g := CreateGenerator("Test [Animal:type=bird]", i)
+	g.UseRandomSource(rng.UseStatic(0))
+	g.UseMissingPolicy(EmptyMissing)
+
+	result, err := g.TryRun()
+
+	s.NoError(err)
+	s.Equal("Test ", result)
+}
+
+func (s *GeneratorSuite) TestRun_Seeded() {
+	i := BuildSampleInventory()
+	g1 := CreateGenerator("[Description] [Animal]", i)
+	g1.UseRandomSource(rng.UseSeeded(99))
+	g2 := CreateGenerator("[Description] [Animal]", i)
+	g2.UseRandomSource(rng.UseSeeded(99))
+
+	for n := 0; n < 20; n++ {
+		s.Equal(g1.Run(), g2.Run())
+	}
+}
+
+func (s *GeneratorSuite) TestRequireSecure() {
+	i := BuildSampleInventory()
+	g := CreateGenerator("Test [Animal]", i)
+
+	g.RequireSecure()
+	s.True(rng.IsSecure(g.rng))
+
+	result, err := g.TryRun()
+	s.NoError(err)
+	s.Contains([]string{"Test Aardvark", "Test Boomalope", "Test Capybara", "Test Cladoselache"}, result)
+
+	g.UseRandomSource(rng.UseStatic(0))
+	_, err = g.TryRun()
+	s.Equal(ErrInsecureSource, err)
+}
+
+func (s *GeneratorSuite) TestEntropy() {
+	i := BuildSampleInventory()
+	g := CreateGenerator("[Animal:family=rodent]-[AnimalType:x]", i)
+	g.UseMissingPolicy(EmptyMissing)
+
+	e, err := g.Entropy(nil)
+
+	s.NoError(err)
+	s.Equal(0.0, e.Shannon)
+	s.Equal(0.0, e.Min)
+}
+
+func (s *GeneratorSuite) TestRunRecorded() {
+	i := BuildSampleInventory()
+	g := CreateGenerator("[Description] [Animal:type=[AnimalType]]", i)
+	g.UseRandomSource(rng.UseSeeded(3))
+
+	result, err := g.RunRecorded(CreateState())
+
+	s.Require().NoError(err)
+	s.NotEmpty(result.Text)
+	s.Len(result.Recording.Values, 3)
+
+	g.UseRandomSource(rng.UseReplay(result.Recording))
+	replayed, err := g.TryRun()
+
+	s.NoError(err)
+	s.Equal(result.Text, replayed)
+}
+
+func (s *GeneratorSuite) TestRunRecorded_IDs() {
+	i := buildIDInventory()
+	g := CreateGenerator("[Plant] [Animal:type=bird] [Animal:type=mammal]", i)
+	g.UseRandomSource(rng.UseSeeded(3))
+
+	result, err := g.RunRecorded(CreateState())
+
+	s.Require().NoError(err)
+	s.Equal([]string{"fern", "dodo"}, result.IDs)
+}
+
+func (s *GeneratorSuite) TestRun_ReplayExhausted() {
+	i := BuildSampleInventory()
+	g := CreateGenerator("[Description] [Animal]", i)
+	g.UseRandomSource(rng.UseReplay(&rng.Recording{Values: []float64{0}}))
+
+	result, err := g.TryRun()
+
+	s.Equal(rng.ErrReplayExhausted, err)
+	s.Empty(result)
+}
+
+func (s *GeneratorSuite) TestRunRecorded_ReplayExhausted() {
+	i := BuildSampleInventory()
+	g := CreateGenerator("[Description] [Animal]", i)
+	g.UseRandomSource(rng.UseReplay(&rng.Recording{Values: []float64{0}}))
+
+	result, err := g.RunRecorded(CreateState())
+
+	s.Equal(rng.ErrReplayExhausted, err)
+	s.Equal([]float64{0, 0}, result.Recording.Values)
+}
+
+func (s *GeneratorSuite) TestRun_Parallel() {
+	i := BuildSampleInventory()
+	i.Freeze()
+
+	shared := CreateGenerator("[Description] [Animal:type=[AnimalType]]", i)
+	shared.UseRandomSource(rng.UseSeeded(1))
+
+	master := rng.UseSeeded(2)
+	streams := CreateGenerator("[Description] [Animal:type=[AnimalType]]", i)
+	streams.UseRandomFactory(func() rng.RandomSource { return master.Split() })
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 400)
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for n := 0; n < 25; n++ {
+				for _, g := range []*Generator{shared, streams} {
+					result, err := g.TryRun()
+					if err == nil && result == "" {
+						err = errors.New("empty result")
+					}
+					if err != nil {
+						errs <- err
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		s.NoError(err)
+	}
+}
+
+func (s *GeneratorSuite) TestUseRandomFactory() {
+	i := BuildSampleInventory()
+	g := CreateGenerator("[Animal]", i)
+
+	created := 0
+	g.UseRandomFactory(func() rng.RandomSource {
+		created++
+		return rng.UseStatic(0)
+	})
+
+	s.Equal("Aardvark", g.Run())
+	s.Equal("Aardvark", g.Run())
+	s.Equal(2, created)
+
+	g.UseRandomSource(rng.UseStatic(1))
+	s.Equal("Cladoselache", g.Run())
+	s.Equal(2, created)
+}
@@ -0,0 +1,169 @@
+/*
+ * Copyright 2020 zpxio (Jeff Sharpe)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package generator
+
+import (
+	"github.com/pkg/errors"
+)
+
+// Get finds the Token with the given ID. The returned Token is a copy, so changing it doesn't affect
+// the Inventory; use ReplaceByID or Update to make changes.
+func (i *Inventory) Get(id string) (Token, bool) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	idx, found := i.findID(id)
+	if !found {
+		return Token{}, false
+	}
+
+	t := i.dictionary[i.ids[id]][idx]
+	t.Properties = copyMap(t.Properties)
+	t.SetVars = copyMap(t.SetVars)
+
+	return t, true
+}
+
+// Remove removes the Token with the given ID, returning false if there is no such Token. Removing
+// from a frozen Inventory panics.
+func (i *Inventory) Remove(id string) bool {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if i.frozen {
+		panic("attempt to remove a token from a frozen inventory")
+	}
+
+	idx, found := i.findID(id)
+	if !found {
+		return false
+	}
+
+	category := i.ids[id]
+	existing := i.dictionary[category]
+	kept := make([]Token, 0, len(existing)-1)
+	kept = append(kept, existing[:idx]...)
+	kept = append(kept, existing[idx+1:]...)
+
+	i.dictionary[category] = kept
+	delete(i.ids, id)
+	totalCategory(i.dictionary, i.selectRange, category)
+
+	return true
+}
+
+// ReplaceByID replaces the Token with the given ID. If the replacement has no ID, it takes the ID of
+// the Token it replaces; it may instead have a new ID, as long as no other Token uses it. A
+// replacement in the same category takes the place of the original Token, keeping its position for
+// weighted selection, while one in a different category is added to the end of that category. The
+// replacement is normalized, and an error is returned if it isn't valid or if there is no Token with
+// the ID. Replacing Tokens in a frozen Inventory panics.
+func (i *Inventory) ReplaceByID(id string, t Token) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	return i.replaceLocked(id, t)
+}
+
+// Update changes the Token with the given ID by passing a copy of it to the function, then replacing
+// the Token with the result as described by ReplaceByID. The Inventory is locked while the function
+// runs, so it must not use the Inventory.
+func (i *Inventory) Update(id string, change func(t *Token)) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if i.frozen {
+		panic("attempt to update a token in a frozen inventory")
+	}
+
+	idx, found := i.findID(id)
+	if !found {
+		return errors.Wrapf(ErrTokenNotFound, "ID %q", id)
+	}
+
+	t := i.dictionary[i.ids[id]][idx]
+	t.Properties = copyMap(t.Properties)
+	t.SetVars = copyMap(t.SetVars)
+	change(&t)
+
+	return i.replaceLocked(id, t)
+}
+
+// replaceLocked replaces the Token with the given ID, as described by ReplaceByID. The caller must
+// hold the write lock.
+func (i *Inventory) replaceLocked(id string, t Token) error {
+	if i.frozen {
+		panic("attempt to replace a token in a frozen inventory")
+	}
+
+	idx, found := i.findID(id)
+	if !found {
+		return errors.Wrapf(ErrTokenNotFound, "ID %q", id)
+	}
+
+	if t.ID == "" {
+		t.ID = id
+	}
+	t.Normalize()
+	if !t.IsValid() {
+		return errors.Errorf("replacement for token %q is not a valid token", id)
+	}
+	if t.ID != id {
+		if _, taken := i.ids[t.ID]; taken {
+			return errors.Wrapf(ErrDuplicateID, "ID %q", t.ID)
+		}
+	}
+	t.compile()
+
+	category := i.ids[id]
+	existing := i.dictionary[category]
+	replaced := make([]Token, 0, len(existing))
+	replaced = append(replaced, existing[:idx]...)
+	if category == t.Category {
+		replaced = append(replaced, t)
+	}
+	replaced = append(replaced, existing[idx+1:]...)
+	i.dictionary[category] = replaced
+
+	if category != t.Category {
+		i.dictionary[t.Category] = append(i.dictionary[t.Category], t)
+		totalCategory(i.dictionary, i.selectRange, t.Category)
+	}
+	totalCategory(i.dictionary, i.selectRange, category)
+
+	delete(i.ids, id)
+	i.ids[t.ID] = t.Category
+
+	return nil
+}
+
+// findID finds the position of the Token with the given ID within its category. The caller must hold
+// the lock.
+func (i *Inventory) findID(id string) (int, bool) {
+	category, found := i.ids[id]
+	if !found || id == "" {
+		return 0, false
+	}
+
+	for idx, t := range i.dictionary[category] {
+		if t.ID == id {
+			return idx, true
+		}
+	}
+
+	return 0, false
+}
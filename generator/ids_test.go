@@ -0,0 +1,202 @@
+/*
+ * Copyright 2020 zpxio (Jeff Sharpe)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package generator
+
+import (
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/suite"
+	"testing"
+)
+
+type IDSuite struct {
+	suite.Suite
+}
+
+func TestIDSuite(t *testing.T) {
+	suite.Run(t, new(IDSuite))
+}
+
+// buildIDInventory builds a sample Inventory in which some Tokens have IDs.
+func buildIDInventory() *Inventory {
+	i := BuildSampleInventory()
+
+	t := BuildToken("Animal", "Dodo", 1.5, Properties{"type": "bird"})
+	t.ID = "dodo"
+	i.Add(t)
+
+	t = BuildToken("Plant", "Fern", 1.0, Properties{})
+	t.ID = "fern"
+	i.Add(t)
+
+	return i
+}
+
+func (s *IDSuite) TestAdd_DuplicateID() {
+	i := buildIDInventory()
+	t := BuildToken("Plant", "Oak", 1.0, Properties{})
+	t.ID = "dodo"
+
+	s.Panics(func() {
+		i.Add(t)
+	})
+}
+
+func (s *IDSuite) TestGet() {
+	i := buildIDInventory()
+
+	t, found := i.Get("dodo")
+
+	s.True(found)
+	s.Equal("Dodo", t.Content)
+	s.Equal("bird", t.Properties["type"])
+
+	t.Properties["type"] = "extinct"
+	again, _ := i.Get("dodo")
+	s.Equal("bird", again.Properties["type"])
+
+	_, found = i.Get("moa")
+	s.False(found)
+
+	_, found = i.Get("")
+	s.False(found)
+}
+
+func (s *IDSuite) TestRemove() {
+	i := buildIDInventory()
+
+	s.True(i.Remove("dodo"))
+
+	s.Len(i.dictionary["Animal"], 4)
+	s.InDelta(6.5, i.selectRange["Animal"], 0.001)
+	_, found := i.Get("dodo")
+	s.False(found)
+	s.False(i.Remove("dodo"))
+}
+
+func (s *IDSuite) TestRemove_LastInCategory() {
+	i := buildIDInventory()
+
+	s.True(i.Remove("fern"))
+
+	s.NotContains(i.dictionary, "Plant")
+	s.NotContains(i.selectRange, "Plant")
+	s.Nil(i.Pick(ParseSelector("Plant", ""), 0.5))
+}
+
+func (s *IDSuite) TestReplaceByID() {
+	i := buildIDInventory()
+
+	err := i.ReplaceByID("dodo", BuildToken("Animal", "Moa", 3.0, Properties{"type": "bird"}))
+
+	s.NoError(err)
+	s.Equal([]string{"Aardvark", "Boomalope", "Capybara", "Cladoselache", "Moa"}, contents(i, "Animal"))
+	s.InDelta(9.5, i.selectRange["Animal"], 0.001)
+	t, found := i.Get("dodo")
+	s.True(found)
+	s.Equal("Moa", t.Content)
+}
+
+func (s *IDSuite) TestReplaceByID_NewID() {
+	i := buildIDInventory()
+	t := BuildToken("Animal", "Moa", 3.0, Properties{})
+	t.ID = "moa"
+
+	s.NoError(i.ReplaceByID("dodo", t))
+
+	_, found := i.Get("dodo")
+	s.False(found)
+	moa, found := i.Get("moa")
+	s.True(found)
+	s.Equal("Moa", moa.Content)
+
+	t.ID = "fern"
+	err := i.ReplaceByID("moa", t)
+	s.True(errors.Is(err, ErrDuplicateID))
+}
+
+func (s *IDSuite) TestReplaceByID_NewCategory() {
+	i := buildIDInventory()
+
+	err := i.ReplaceByID("dodo", BuildToken("Plant", "Moss", 0.5, Properties{}))
+
+	s.NoError(err)
+	s.Len(i.dictionary["Animal"], 4)
+	s.InDelta(6.5, i.selectRange["Animal"], 0.001)
+	s.Equal([]string{"Fern", "Moss"}, contents(i, "Plant"))
+	s.InDelta(1.5, i.selectRange["Plant"], 0.001)
+	s.Equal("Plant", i.ids["dodo"])
+}
+
+func (s *IDSuite) TestReplaceByID_Errors() {
+	i := buildIDInventory()
+
+	err := i.ReplaceByID("moa", BuildToken("Animal", "Moa", 1.0, Properties{}))
+	s.True(errors.Is(err, ErrTokenNotFound))
+	s.Contains(err.Error(), `"moa"`)
+
+	err = i.ReplaceByID("dodo", BuildToken("Animal", "", 1.0, Properties{}))
+	s.Error(err)
+	s.Equal("Dodo", i.dictionary["Animal"][4].Content)
+}
+
+func (s *IDSuite) TestUpdate() {
+	i := buildIDInventory()
+
+	err := i.Update("dodo", func(t *Token) {
+		t.Rarity = 0.5
+		t.Properties["status"] = "extinct"
+	})
+
+	s.NoError(err)
+	t, _ := i.Get("dodo")
+	s.Equal(0.5, t.Rarity)
+	s.Equal("extinct", t.Properties["status"])
+	s.InDelta(7.0, i.selectRange["Animal"], 0.001)
+
+	err = i.Update("moa", func(t *Token) {})
+	s.True(errors.Is(err, ErrTokenNotFound))
+}
+
+func (s *IDSuite) TestFrozen() {
+	i := buildIDInventory()
+	i.Freeze()
+
+	t, found := i.Get("dodo")
+	s.True(found)
+	s.Panics(func() { i.Remove("dodo") })
+	s.Panics(func() { _ = i.ReplaceByID("dodo", t) })
+	s.Panics(func() { _ = i.Update("dodo", func(t *Token) {}) })
+}
+
+func (s *IDSuite) TestSnapshot() {
+	i := buildIDInventory()
+
+	x := i.Snapshot()
+	i.Remove("dodo")
+
+	_, found := x.Get("dodo")
+	s.True(found)
+}
+
+func (s *IDSuite) TestPick_AfterChanges() {
+	i := buildIDInventory()
+	s.NoError(i.Update("dodo", func(t *Token) { t.Rarity = 100 }))
+
+	t := i.Pick(ParseSelector("Animal", ""), 0.99)
+
+	s.Equal("Dodo", t.Content)
+}
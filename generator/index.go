@@ -0,0 +1,244 @@
+/*
+ * Copyright 2020 zpxio (Jeff Sharpe)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package generator
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// selectionCacheMax limits the number of distinct Selectors whose matching Tokens are cached by a
+// frozen Inventory.
+const selectionCacheMax = 4096
+
+// selection is a list of Tokens which match a Selector, along with the running total of their
+// rarities. The final cumulative value is the select range of the Tokens.
+type selection struct {
+	tokens     []Token
+	cumulative []float64
+}
+
+// newSelection builds a selection for the Tokens.
+func newSelection(tokens []Token) *selection {
+	s := &selection{
+		tokens:     tokens,
+		cumulative: make([]float64, len(tokens)),
+	}
+
+	total := 0.0
+	for idx := range tokens {
+		total += tokens[idx].Rarity
+		s.cumulative[idx] = total
+	}
+
+	return s
+}
+
+// total returns the sum of the rarities of the selected Tokens.
+func (s *selection) total() float64 {
+	if len(s.cumulative) == 0 {
+		return 0.0
+	}
+
+	return s.cumulative[len(s.cumulative)-1]
+}
+
+// pick finds the Token at the given offset (0 <= offset < 1) through the weighted range of Tokens
+// using a binary search. If the selection is empty, nil is returned.
+func (s *selection) pick(offset float64) *Token {
+	if len(s.tokens) == 0 {
+		return nil
+	}
+
+	selectValue := offset * s.total()
+	idx := sort.Search(len(s.cumulative), func(n int) bool {
+		return s.cumulative[n] > selectValue
+	})
+	if idx == len(s.tokens) {
+		idx--
+	}
+
+	return &s.tokens[idx]
+}
+
+// categoryIndex holds lookup tables for the Tokens of a single category in a frozen Inventory.
+type categoryIndex struct {
+	all *selection
+
+	// values maps a property name and value to the positions of Tokens with that value
+	values map[string]map[string][]int
+	// present maps a property name to the positions of Tokens which have it
+	present map[string][]int
+}
+
+// buildIndex creates the lookup tables for a category's Tokens.
+func buildIndex(tokens []Token) *categoryIndex {
+	x := &categoryIndex{
+		all:     newSelection(tokens),
+		values:  make(map[string]map[string][]int),
+		present: make(map[string][]int),
+	}
+
+	for pos := range tokens {
+		for k, v := range tokens[pos].Properties {
+			if x.values[k] == nil {
+				x.values[k] = make(map[string][]int)
+			}
+			x.values[k][v] = append(x.values[k][v], pos)
+			x.present[k] = append(x.present[k], pos)
+		}
+	}
+
+	return x
+}
+
+// match finds the Tokens which match a Selector for this category. Positions are found by
+// intersecting the lists for required and existing properties, then removing the lists for excluded
+// properties, so the work done is proportional to the number of Tokens with the requested properties
+// rather than the size of the category.
+func (x *categoryIndex) match(s *Selector) *selection {
+	var lists [][]int
+	exact := true
+
+	for k, v := range s.Require {
+		if v == "" {
+			// An empty value also matches Tokens without the property
+			exact = false
+			continue
+		}
+		lists = append(lists, x.values[k][v])
+	}
+	for k := range s.Exists {
+		lists = append(lists, x.present[k])
+	}
+
+	var positions []int
+	if len(lists) == 0 {
+		positions = make([]int, len(x.all.tokens))
+		for pos := range positions {
+			positions[pos] = pos
+		}
+	} else {
+		sort.Slice(lists, func(a, b int) bool { return len(lists[a]) < len(lists[b]) })
+		positions = lists[0]
+		for _, l := range lists[1:] {
+			positions = intersect(positions, l)
+		}
+	}
+
+	for k, v := range s.Exclude {
+		if v == "" {
+			exact = false
+			continue
+		}
+		positions = subtract(positions, x.values[k][v])
+	}
+
+	tokens := make([]Token, 0, len(positions))
+	for _, pos := range positions {
+		t := &x.all.tokens[pos]
+		if exact || s.MatchesToken(t) {
+			tokens = append(tokens, *t)
+		}
+	}
+
+	return newSelection(tokens)
+}
+
+// intersect returns the positions which appear in both sorted lists.
+func intersect(a []int, b []int) []int {
+	result := make([]int, 0, len(a))
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		switch {
+		case a[i] < b[j]:
+			i++
+		case a[i] > b[j]:
+			j++
+		default:
+			result = append(result, a[i])
+			i++
+			j++
+		}
+	}
+
+	return result
+}
+
+// subtract returns the positions in the sorted list a which don't appear in the sorted list b.
+func subtract(a []int, b []int) []int {
+	if len(b) == 0 {
+		return a
+	}
+
+	result := make([]int, 0, len(a))
+	j := 0
+	for _, pos := range a {
+		for j < len(b) && b[j] < pos {
+			j++
+		}
+		if j < len(b) && b[j] == pos {
+			continue
+		}
+		result = append(result, pos)
+	}
+
+	return result
+}
+
+// inventoryIndex holds the lookup tables of a frozen Inventory, along with a cache of the Tokens
+// matching recently used Selectors.
+type inventoryIndex struct {
+	categories map[string]*categoryIndex
+
+	cache     sync.Map
+	cacheSize int32
+}
+
+// buildInventoryIndex creates lookup tables for every category in the dictionary.
+func buildInventoryIndex(dictionary map[string][]Token) *inventoryIndex {
+	x := &inventoryIndex{categories: make(map[string]*categoryIndex, len(dictionary))}
+	for category, tokens := range dictionary {
+		x.categories[category] = buildIndex(tokens)
+	}
+
+	return x
+}
+
+// selection finds the Tokens matching the Selector.
+func (x *inventoryIndex) selection(s *Selector) *selection {
+	c, found := x.categories[s.Category]
+	if !found {
+		return &selection{}
+	}
+
+	if s.IsSimple() {
+		return c.all
+	}
+
+	key := s.key()
+	if cached, ok := x.cache.Load(key); ok {
+		return cached.(*selection)
+	}
+
+	result := c.match(s)
+	if atomic.AddInt32(&x.cacheSize, 1) <= selectionCacheMax {
+		x.cache.Store(key, result)
+	}
+
+	return result
+}
@@ -0,0 +1,159 @@
+/*
+ * Copyright 2020 zpxio (Jeff Sharpe)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package generator
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/suite"
+	"github.com/zpxio/octogen/rng"
+	"testing"
+)
+
+type IndexSuite struct {
+	suite.Suite
+}
+
+func TestIndexSuite(t *testing.T) {
+	suite.Run(t, new(IndexSuite))
+}
+
+// buildLargeInventory creates a category of names with a few properties and varied rarities.
+func buildLargeInventory(n int) *Inventory {
+	i := CreateInventory()
+	for x := 0; x < n; x++ {
+		props := Properties{
+			"gender": []string{"f", "m", "n"}[x%3],
+			"origin": fmt.Sprintf("o%d", x%17),
+		}
+		if x%5 == 0 {
+			props["rare"] = ""
+		}
+		i.AddToken("Name", fmt.Sprintf("Name%d", x), float64(1+x%7)/2, props)
+	}
+
+	return i
+}
+
+func (s *IndexSuite) TestIntersect() {
+	s.Equal([]int{2, 5}, intersect([]int{1, 2, 5, 9}, []int{0, 2, 3, 5}))
+	s.Empty(intersect([]int{1}, nil))
+}
+
+func (s *IndexSuite) TestSubtract() {
+	s.Equal([]int{1, 9}, subtract([]int{1, 2, 5, 9}, []int{0, 2, 3, 5}))
+	s.Equal([]int{1}, subtract([]int{1}, nil))
+}
+
+func (s *IndexSuite) TestSelectionPick() {
+	tokens := []Token{
+		BuildToken("A", "a", 1.0, Properties{}),
+		BuildToken("A", "b", 2.0, Properties{}),
+		BuildToken("A", "c", 1.0, Properties{}),
+	}
+	sel := newSelection(tokens)
+
+	s.InDelta(4.0, sel.total(), 1e-9)
+	s.Equal("a", sel.pick(0).Content)
+	s.Equal("a", sel.pick(0.2499).Content)
+	s.Equal("b", sel.pick(0.25).Content)
+	s.Equal("b", sel.pick(0.7499).Content)
+	s.Equal("c", sel.pick(0.75).Content)
+	s.Equal("c", sel.pick(1.0).Content)
+	s.Nil(newSelection(nil).pick(0.5))
+}
+
+func (s *IndexSuite) TestFrozenPickMatchesLinear() {
+	linear := buildLargeInventory(500)
+	frozen := linear.Snapshot()
+
+	selectors := []string{"", "gender=f", "gender=m,origin=o3", "gender!=n", "rare", "rare,gender=f,origin!=o2", "origin=o99", "gender=f,gender!=f"}
+	r := rng.UseSeeded(4)
+
+	for _, opts := range selectors {
+		sel := ParseSelector("Name", opts)
+
+		lt, lr := linear.getTokens(sel)
+		ft, fr := frozen.getTokens(sel)
+		s.Equal(len(lt), len(ft), opts)
+		s.InDelta(lr, fr, 1e-9, opts)
+
+		for n := 0; n < 200; n++ {
+			offset := r.Next()
+			expected := linear.Pick(sel, offset)
+			actual := frozen.Pick(sel, offset)
+			if expected == nil {
+				s.Nil(actual, opts)
+			} else if s.NotNil(actual, opts) {
+				s.Equal(expected.Content, actual.Content, opts)
+			}
+		}
+	}
+}
+
+func (s *IndexSuite) TestFrozenEmptyValues() {
+	i := CreateInventory()
+	i.AddToken("A", "none", 1.0, Properties{})
+	i.AddToken("A", "empty", 1.0, Properties{"x": ""})
+	i.AddToken("A", "set", 1.0, Properties{"x": "1"})
+	i.Freeze()
+
+	req := newSelector("A")
+	req.addOption("x", optTypeRequire, "")
+	tokens, _ := i.getTokens(req)
+	s.Len(tokens, 2)
+
+	exc := newSelector("A")
+	exc.addOption("x", optTypeExclude, "")
+	tokens, _ = i.getTokens(exc)
+	s.Len(tokens, 2)
+	s.Equal("none", tokens[0].Content)
+	s.Equal("set", tokens[1].Content)
+}
+
+func (s *IndexSuite) TestFrozenMissingCategory() {
+	i := BuildSampleInventory()
+	i.Freeze()
+
+	s.Nil(i.Pick(ParseSelector("ZipCode", ""), 0.5))
+	s.Nil(i.Pick(ParseSelector("Animal", "type=bird"), 0.5))
+}
+
+func benchmarkPick(b *testing.B, i *Inventory, options string) {
+	sel := ParseSelector("Name", options)
+	r := rng.UseSeeded(1)
+
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		i.Pick(sel, r.Next())
+	}
+}
+
+func BenchmarkPick_Linear_Simple(b *testing.B) {
+	benchmarkPick(b, buildLargeInventory(50000), "")
+}
+
+func BenchmarkPick_Indexed_Simple(b *testing.B) {
+	benchmarkPick(b, buildLargeInventory(50000).Snapshot(), "")
+}
+
+func BenchmarkPick_Linear_Tagged(b *testing.B) {
+	benchmarkPick(b, buildLargeInventory(50000), "gender=f,origin=o3")
+}
+
+func BenchmarkPick_Indexed_Tagged(b *testing.B) {
+	benchmarkPick(b, buildLargeInventory(50000).Snapshot(), "gender=f,origin=o3")
+}
@@ -17,16 +17,31 @@
 package generator
 
 import (
+	"bytes"
+	"fmt"
 	"github.com/pkg/errors"
-	"gopkg.in/yaml.v2"
-	"io/ioutil"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"sync"
 )
 
 // Inventory acts as a collection of categorized Tokens which can be queried for both randomized
 // and parameterized selection.
+//
+// An Inventory is safe for concurrent use: Tokens may be added while other goroutines pick from it.
+// Once an Inventory has been fully built, it can be frozen with Freeze, or copied to a frozen
+// Snapshot, which guarantees that it will never change while it is being read. Frozen Inventories
+// are also indexed, making picks from large categories much faster.
 type Inventory struct {
+	mu          sync.RWMutex
+	frozen      bool
+	index       *inventoryIndex
 	dictionary  map[string][]Token
 	selectRange map[string]float64
+	ids         map[string]string
 }
 
 // CreateInventory creates a new, empty Inventory.
@@ -34,6 +49,7 @@ func CreateInventory() *Inventory {
 	i := Inventory{
 		dictionary:  make(map[string][]Token),
 		selectRange: make(map[string]float64),
+		ids:         make(map[string]string),
 	}
 
 	return &i
@@ -41,23 +57,90 @@ func CreateInventory() *Inventory {
 
 // AddToken creates and adds a new Token to this Inventory. The created token is returned to support
 // chaining and to make it interchangeable with Add.
-func (i *Inventory) AddToken(id string, content string, rarity float64, tags map[string]string) *Token {
-	x := BuildToken(id, content, rarity, tags)
+func (i *Inventory) AddToken(category string, content string, rarity float64, tags map[string]string) *Token {
+	x := BuildToken(category, content, rarity, tags)
 
 	return i.Add(x)
 }
 
 // Add adds an existing Token to this Inventory. The added token is returned, to help support chaining
-// and make it interchangeable with AddToken.
+// and make it interchangeable with AddToken. The Token must not be modified once the Inventory is in
+// use by a Generator; use ReplaceByID or Update to change Tokens which have an ID. Adding to a frozen
+// Inventory, or adding a Token whose ID is already in use, panics.
 func (i *Inventory) Add(t Token) *Token {
+	t.compile()
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if i.frozen {
+		panic("attempt to add a token to a frozen inventory")
+	}
+
+	if t.ID != "" {
+		if _, taken := i.ids[t.ID]; taken {
+			panic(fmt.Sprintf("attempt to add a token with duplicate ID %q", t.ID))
+		}
+		i.ids[t.ID] = t.Category
+	}
+
 	i.dictionary[t.Category] = append(i.dictionary[t.Category], t)
 	i.selectRange[t.Category] += t.Rarity
 
 	return &t
 }
 
-// getTokens retrieves tokens that match the supplied Selector.
+// Freeze prevents any further Tokens from being added to the Inventory, and builds indexes of the
+// Tokens' rarities and properties so that later picks don't need to scan every Token.
+func (i *Inventory) Freeze() {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if !i.frozen {
+		i.frozen = true
+		i.index = buildInventoryIndex(i.dictionary)
+	}
+}
+
+// IsFrozen checks if the Inventory has been frozen.
+func (i *Inventory) IsFrozen() bool {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	return i.frozen
+}
+
+// Snapshot creates a frozen copy of the Inventory. Later changes to this Inventory don't affect the
+// snapshot.
+func (i *Inventory) Snapshot() *Inventory {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	s := CreateInventory()
+	for category, tokens := range i.dictionary {
+		s.dictionary[category] = append([]Token(nil), tokens...)
+		s.selectRange[category] = i.selectRange[category]
+	}
+	for id, category := range i.ids {
+		s.ids[id] = category
+	}
+	s.frozen = true
+	s.index = buildInventoryIndex(s.dictionary)
+
+	return s
+}
+
+// getTokens retrieves tokens that match the supplied Selector. The returned slice must not be
+// modified.
 func (i *Inventory) getTokens(selector *Selector) ([]Token, float64) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	if i.index != nil {
+		sel := i.index.selection(selector)
+		return sel.tokens, sel.total()
+	}
+
 	idList, idFound := i.dictionary[selector.Category]
 
 	if !idFound {
@@ -68,7 +151,7 @@ func (i *Inventory) getTokens(selector *Selector) ([]Token, float64) {
 	selectRange := 0.0
 
 	if selector.IsSimple() {
-		return idList, i.selectRange[selector.Category]
+		return idList[:len(idList):len(idList)], i.selectRange[selector.Category]
 	}
 
 	for _, x := range idList {
@@ -84,45 +167,241 @@ func (i *Inventory) getTokens(selector *Selector) ([]Token, float64) {
 // Pick selects a random Token from the inventory which matches the given Selector. If no matching
 // Tokens are found, then nil is returned.
 func (i *Inventory) Pick(selector *Selector, offset float64) *Token {
+	if index := i.frozenIndex(); index != nil {
+		return index.selection(selector).pick(offset)
+	}
+
 	taggedList, selectRange := i.getTokens(selector)
 
-	// Pick the first value that exceeds the offset value
-	selectValue := offset * selectRange
-	var lastToken *Token
+	return pickToken(taggedList, selectRange, offset)
+}
 
-	for len(taggedList) > 0 && selectValue >= 0 {
-		lastToken = &taggedList[0]
-		taggedList = taggedList[1:]
+// pickToken finds the Token at the given offset (0 <= offset < 1) through the weighted range of
+// Tokens, whose Rarities add up to the total. If there are no Tokens, nil is returned.
+func pickToken(tokens []Token, total float64, offset float64) *Token {
+	// Pick the first token whose cumulative rarity exceeds the offset value
+	selectValue := offset * total
+	cumulative := 0.0
 
-		selectValue -= lastToken.Rarity
+	for idx := range tokens {
+		cumulative += tokens[idx].Rarity
+		if selectValue < cumulative {
+			return &tokens[idx]
+		}
 	}
 
-	return lastToken
+	if len(tokens) > 0 {
+		return &tokens[len(tokens)-1]
+	}
+
+	return nil
+}
+
+// frozenIndex retrieves the index of a frozen Inventory, or nil if the Inventory isn't frozen.
+func (i *Inventory) frozenIndex() *inventoryIndex {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	return i.index
 }
 
-// Load adds Tokens to the Inventory from a YAML file containing an array of Token definitions.
+// Load adds Tokens to the Inventory from a file containing an array of Token definitions. The format of
+// the file is detected from its extension, as described by FormatForPath. Entries which aren't valid
+// Tokens are skipped; use LoadWithReport to find out which entries were skipped.
 func (i *Inventory) Load(path string) error {
-	// Read the file
-	data, err := ioutil.ReadFile(path)
+	_, err := i.LoadWithReport(path, LoadOptions{})
+
+	return err
+}
+
+// LoadWithReport adds Tokens to the Inventory from a file containing an array of Token definitions,
+// returning a LoadReport which lists every problem found along with its location in the file. If strict
+// loading is requested and any problems are found, a *ValidationError is returned along with the report.
+// Every format is validated in the same way. Loading into a frozen Inventory returns ErrFrozen.
+//
+// The file may instead be a manifest: a map whose "tokens" setting holds the Token definitions, and
+// which may also set:
+//
+//	include: files, globs or directories to load first, relative to the manifest
+//	mode:    "append" (the default) or "replace", the MergeMode used to add the tokens
+//	remove:  selectors, such as "[Animal:type=cryptid]", matching Tokens to remove
+//	scale:   a map of categories to factors which their rarities are multiplied by
+//
+// Included files are loaded first, and may be manifests themselves. The other settings are then
+// applied to everything loaded before them, as described by MergePolicy, including Tokens which were
+// already in the Inventory. This allows overlays to be layered over a shared base inventory.
+func (i *Inventory) LoadWithReport(path string, opts LoadOptions) (*LoadReport, error) {
+	l := newLoader(osSource{})
+
+	top, err := l.loadFile(path, opts.Format)
 	if err != nil {
-		return errors.Wrap(err, "Failed to read inventory file.")
+		return nil, err
 	}
 
-	// Parse the YAML tokens
-	var tokens []Token
-	err = yaml.Unmarshal(data, &tokens)
+	return l.apply(i, []*layer{top}, opts)
+}
+
+// LoadReader adds Tokens to the Inventory from a stream containing an array of Token definitions in
+// the given Format. Since a stream has no file extension, FormatAuto is treated as YAML.
+func (i *Inventory) LoadReader(r io.Reader, format Format) error {
+	_, err := i.LoadReaderWithReport(r, "", LoadOptions{Format: format})
+
+	return err
+}
+
+// LoadReaderWithReport adds Tokens to the Inventory from a stream, returning a LoadReport in the same
+// way as LoadWithReport. The name labels the issues in the report, and is used to detect the format
+// if none is given in the options. Since there is no file system to read them from, manifests read
+// from a stream can't include other files.
+func (i *Inventory) LoadReaderWithReport(r io.Reader, name string, opts LoadOptions) (*LoadReport, error) {
+	var buf bytes.Buffer
+	if _, err := buf.ReadFrom(r); err != nil {
+		return nil, errors.Wrap(err, "Failed to read inventory.")
+	}
+
+	l := newLoader(nil)
+
+	top, err := l.load(name, buf.Bytes(), opts.Format)
 	if err != nil {
-		return errors.Wrap(err, "Failed to parse yaml file")
+		return nil, err
 	}
 
-	// Add all the tokens
-	for _, t := range tokens {
-		t.Normalize()
+	return l.apply(i, []*layer{top}, opts)
+}
+
+// LoadFS adds Tokens to the Inventory from every inventory file in a file system which matches the
+// pattern, as described by LoadFSWithReport. This allows inventories embedded with go:embed to be
+// loaded directly:
+//
+//	//go:embed inventory
+//	var inventoryFiles embed.FS
+//
+//	err := inv.LoadFS(inventoryFiles, "inventory")
+func (i *Inventory) LoadFS(fsys fs.FS, pattern string) error {
+	_, err := i.LoadFSWithReport(fsys, pattern, LoadOptions{})
+
+	return err
+}
 
-		if t.IsValid() {
-			i.Add(t)
+// LoadFSWithReport adds Tokens to the Inventory from every inventory file in a file system which
+// matches the pattern, using the syntax of fs.Glob. Matching directories are searched recursively
+// for files with a recognized extension (.yml, .yaml, .json, .toml or .csv), so an entire tree of
+// category files can be loaded with a single call. Files are loaded in lexical order, and the
+// format of each is detected from its extension unless one is given in the options. Files
+// included by manifests are read from the same file system.
+//
+// Every file is read and validated before any Tokens are added. If any file can't be read or
+// parsed, or if strict loading finds a problem in any file, nothing is added. It is an error for
+// the pattern to match no inventory files.
+func (i *Inventory) LoadFSWithReport(fsys fs.FS, pattern string, opts LoadOptions) (*LoadReport, error) {
+	paths, err := findInventoryFiles(fsys, pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	l := newLoader(dirSource{fsys})
+	var layers []*layer
+
+	for _, p := range paths {
+		top, err := l.loadFile(p, opts.Format)
+		if err != nil {
+			return nil, err
 		}
+		layers = append(layers, top)
 	}
 
-	return nil
+	return l.apply(i, layers, opts)
+}
+
+// LoadPaths adds Tokens to the Inventory from files on disk, as described by LoadPathsWithReport.
+func (i *Inventory) LoadPaths(paths []string) error {
+	_, err := i.LoadPathsWithReport(paths, LoadOptions{})
+
+	return err
+}
+
+// LoadPathsWithReport adds Tokens to the Inventory from files on disk. Each path may name a file, a
+// directory which is searched for inventory files as described by LoadFSWithReport, or a glob
+// pattern. Files are loaded in the order the paths are given. As with LoadFSWithReport, every file
+// is read and validated before any Tokens are added.
+func (i *Inventory) LoadPathsWithReport(paths []string, opts LoadOptions) (*LoadReport, error) {
+	l := newLoader(osSource{})
+	var layers []*layer
+
+	for _, pattern := range paths {
+		files, err := findInventoryFiles(osSource{}, pattern)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, p := range files {
+			top, err := l.loadFile(p, opts.Format)
+			if err != nil {
+				return nil, err
+			}
+			layers = append(layers, top)
+		}
+	}
+
+	return l.apply(i, layers, opts)
+}
+
+// inventoryExtensions are the file extensions recognized when searching directories for inventories.
+var inventoryExtensions = map[string]bool{
+	".yml":  true,
+	".yaml": true,
+	".json": true,
+	".toml": true,
+	".csv":  true,
+}
+
+// findInventoryFiles lists the files in a file system which match a glob pattern, expanding
+// directories to the inventory files they contain.
+func findInventoryFiles(fsys fs.FS, pattern string) ([]string, error) {
+	matches, err := fs.Glob(fsys, pattern)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Invalid inventory pattern %q.", pattern)
+	}
+
+	var paths []string
+	seen := make(map[string]bool)
+	add := func(p string) {
+		if !seen[p] {
+			seen[p] = true
+			paths = append(paths, p)
+		}
+	}
+
+	for _, m := range matches {
+		info, err := fs.Stat(fsys, m)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Failed to read inventory file %s.", m)
+		}
+
+		if !info.IsDir() {
+			add(m)
+			continue
+		}
+
+		err = fs.WalkDir(fsys, m, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !d.IsDir() && inventoryExtensions[strings.ToLower(path.Ext(p))] {
+				add(p)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, errors.Wrapf(err, "Failed to search inventory directory %s.", m)
+		}
+	}
+
+	if len(paths) == 0 {
+		return nil, errors.Errorf("No inventory files match %q.", pattern)
+	}
+
+	sort.Strings(paths)
+
+	return paths, nil
 }
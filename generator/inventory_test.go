@@ -17,10 +17,14 @@
 package generator
 
 import (
+	"fmt"
 	"github.com/stretchr/testify/suite"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
+	"testing/fstest"
 )
 
 type InventorySuite struct {
@@ -207,3 +211,197 @@ func (s *InventorySuite) TestLoad_PartiallyBadFile() {
 	s.Len(i.dictionary["AnimalType"], 3)
 
 }
+
+func (s *InventorySuite) TestAdd_Concurrent() {
+	i := BuildSampleInventory()
+
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(2)
+		go func(w int) {
+			defer wg.Done()
+			for n := 0; n < 100; n++ {
+				i.AddToken("Animal", fmt.Sprintf("Animal-%d-%d", w, n), 1.0, Properties{"type": "mammal"})
+			}
+		}(w)
+		go func() {
+			defer wg.Done()
+			for n := 0; n < 100; n++ {
+				s.NotNil(i.Pick(ParseSelector("Animal", "type=mammal"), 0.5))
+			}
+		}()
+	}
+	wg.Wait()
+
+	s.Len(i.dictionary["Animal"], 404)
+	s.InDelta(406.5, i.selectRange["Animal"], 0.001)
+}
+
+func (s *InventorySuite) TestFreeze() {
+	i := BuildSampleInventory()
+	s.False(i.IsFrozen())
+
+	i.Freeze()
+
+	s.True(i.IsFrozen())
+	s.Panics(func() {
+		i.AddToken("Animal", "Dodo", 1.0, Properties{})
+	})
+	s.NotNil(i.Pick(ParseSelector("Animal", ""), 0.5))
+}
+
+func (s *InventorySuite) TestSnapshot() {
+	i := BuildSampleInventory()
+
+	x := i.Snapshot()
+	i.AddToken("Animal", "Dodo", 1.0, Properties{})
+
+	s.True(x.IsFrozen())
+	s.False(i.IsFrozen())
+	s.Len(x.dictionary["Animal"], 4)
+	s.Len(i.dictionary["Animal"], 5)
+	s.InDelta(6.5, x.selectRange["Animal"], 0.001)
+	s.Equal("Cladoselache", x.Pick(ParseSelector("Animal", ""), 1.0).Content)
+}
+
+func (s *InventorySuite) TestLoadReader() {
+	i := CreateInventory()
+
+	err := i.LoadReader(strings.NewReader(`[{"category": "Animal", "content": "Okapi", "rarity": 0.5}]`), FormatJSON)
+
+	s.NoError(err)
+	s.Require().Len(i.dictionary["Animal"], 1)
+	s.Equal("Okapi", i.dictionary["Animal"][0].Content)
+	s.InDelta(0.5, i.selectRange["Animal"], 0.001)
+}
+
+func (s *InventorySuite) TestLoadReader_AutoIsYaml() {
+	i := CreateInventory()
+
+	err := i.LoadReader(strings.NewReader("- category: Animal\n  content: Okapi\n"), FormatAuto)
+
+	s.NoError(err)
+	s.Len(i.dictionary["Animal"], 1)
+}
+
+func (s *InventorySuite) TestLoadReaderWithReport_Name() {
+	i := CreateInventory()
+
+	report, err := i.LoadReaderWithReport(strings.NewReader("category,content\nAnimal,\n"), "upload.csv", LoadOptions{})
+
+	s.NoError(err)
+	s.Equal(0, report.Loaded)
+	s.Require().Len(report.Issues, 1)
+	s.Equal("upload.csv", report.Issues[0].File)
+	s.Equal(IssueMissingContent, report.Issues[0].Kind)
+}
+
+func (s *InventorySuite) TestLoadReader_BadData() {
+	i := CreateInventory()
+
+	err := i.LoadReader(strings.NewReader("{"), FormatJSON)
+
+	s.Error(err)
+	s.Empty(i.dictionary)
+}
+
+func sampleFS() fstest.MapFS {
+	return fstest.MapFS{
+		"inventory/animals.yml":        {Data: []byte("- category: Animal\n  content: Okapi\n")},
+		"inventory/plants/trees.json":  {Data: []byte(`[{"category": "Plant", "content": "Oak"}]`)},
+		"inventory/plants/flowers.csv": {Data: []byte("category,content\nPlant,Daisy\nPlant,Tulip\n")},
+		"inventory/plants/README.md":   {Data: []byte("Not an inventory")},
+		"inventory/minerals.toml":      {Data: []byte("[[tokens]]\ncategory = \"Mineral\"\ncontent = \"Quartz\"\n")},
+		"other/extra.yml":              {Data: []byte("- category: Animal\n  content: Tapir\n")},
+		"broken/bad.yml":               {Data: []byte("- category: Animal\n  content: Dodo\n- category: Animal\n")},
+		"broken/good.yml":              {Data: []byte("- category: Animal\n  content: Kiwi\n")},
+	}
+}
+
+func (s *InventorySuite) TestLoadFS_Directory() {
+	i := CreateInventory()
+
+	err := i.LoadFS(sampleFS(), "inventory")
+
+	s.NoError(err)
+	s.Len(i.dictionary, 3)
+	s.Len(i.dictionary["Animal"], 1)
+	s.Len(i.dictionary["Mineral"], 1)
+	s.Require().Len(i.dictionary["Plant"], 3)
+
+	// Files are loaded in lexical order
+	s.Equal("Daisy", i.dictionary["Plant"][0].Content)
+	s.Equal("Tulip", i.dictionary["Plant"][1].Content)
+	s.Equal("Oak", i.dictionary["Plant"][2].Content)
+}
+
+func (s *InventorySuite) TestLoadFS_Glob() {
+	i := CreateInventory()
+
+	err := i.LoadFS(sampleFS(), "*/*.yml")
+
+	s.NoError(err)
+	s.Len(i.dictionary["Animal"], 4)
+	s.Empty(i.dictionary["Plant"])
+}
+
+func (s *InventorySuite) TestLoadFS_NoMatch() {
+	i := CreateInventory()
+
+	err := i.LoadFS(sampleFS(), "*.yml")
+
+	s.Error(err)
+	s.Contains(err.Error(), "No inventory files match")
+}
+
+func (s *InventorySuite) TestLoadFS_BadPattern() {
+	i := CreateInventory()
+
+	err := i.LoadFS(sampleFS(), "[")
+
+	s.Error(err)
+}
+
+func (s *InventorySuite) TestLoadFS_Report() {
+	i := CreateInventory()
+
+	report, err := i.LoadFSWithReport(sampleFS(), "broken", LoadOptions{})
+
+	s.NoError(err)
+	s.Equal(2, report.Loaded)
+	s.Require().Len(report.Issues, 1)
+	s.Equal("broken/bad.yml", report.Issues[0].File)
+	s.Len(i.dictionary["Animal"], 2)
+}
+
+func (s *InventorySuite) TestLoadFS_StrictLoadsNothing() {
+	i := CreateInventory()
+
+	report, err := i.LoadFSWithReport(sampleFS(), "broken", LoadOptions{Strict: true})
+
+	s.Error(err)
+	s.IsType(&ValidationError{}, err)
+	s.Equal(0, report.Loaded)
+	s.Empty(i.dictionary)
+}
+
+func (s *InventorySuite) TestLoadFS_ParseErrorLoadsNothing() {
+	fsys := sampleFS()
+	fsys["inventory/zzz.json"] = &fstest.MapFile{Data: []byte("{")}
+	i := CreateInventory()
+
+	err := i.LoadFS(fsys, "inventory")
+
+	s.Error(err)
+	s.Contains(err.Error(), "inventory/zzz.json")
+	s.Empty(i.dictionary)
+}
+
+func (s *InventorySuite) TestLoadFS_DirFS() {
+	i := CreateInventory()
+
+	err := i.LoadFS(os.DirFS(DataDir()), "inv_animals.*")
+
+	s.NoError(err)
+	s.Len(i.dictionary["Animal"], 16)
+}
@@ -0,0 +1,683 @@
+/*
+ * Copyright 2020 zpxio (Jeff Sharpe)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package generator
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// LintKind identifies the type of problem found by Lint.
+type LintKind int
+
+const (
+	// LintSyntax means an instruction or Token content can't be parsed.
+	LintSyntax LintKind = iota
+	// LintMissingCategory means a selector refers to a category with no Tokens.
+	LintMissingCategory
+	// LintUnmatchable means a selector's property filters can never match any Token.
+	LintUnmatchable
+	// LintUnsetVariable means a variable is referenced, but nothing ever sets it.
+	LintUnsetVariable
+	// LintCycle means categories refer to each other, so rendering them can exceed RoundsMax.
+	LintCycle
+	// LintDuplicateContent means a category has more than one Token with the same content.
+	LintDuplicateContent
+	// LintUnsetCapture means a capture is referenced, but no selector ever makes it.
+	LintUnsetCapture
+	// LintExhaustedRepeat means a unique {repeat} block can pick more Tokens from a category than
+	// its selectors can match, so it runs out of Tokens.
+	LintExhaustedRepeat
+)
+
+// String describes the LintKind.
+func (k LintKind) String() string {
+	switch k {
+	case LintSyntax:
+		return "syntax"
+	case LintMissingCategory:
+		return "missing category"
+	case LintUnmatchable:
+		return "unmatchable selector"
+	case LintUnsetVariable:
+		return "unset variable"
+	case LintCycle:
+		return "cycle"
+	case LintDuplicateContent:
+		return "duplicate content"
+	case LintUnsetCapture:
+		return "unset capture"
+	case LintExhaustedRepeat:
+		return "exhausted repeat"
+	}
+
+	return "unknown"
+}
+
+// LintSeverity indicates how serious a LintIssue is.
+type LintSeverity int
+
+const (
+	// LintWarning means the problem may produce unexpected output, but won't make rendering fail.
+	LintWarning LintSeverity = iota
+	// LintError means rendering fails, or always will when the problem is reached.
+	LintError
+)
+
+// String describes the LintSeverity.
+func (s LintSeverity) String() string {
+	if s == LintError {
+		return "error"
+	}
+
+	return "warning"
+}
+
+// LintIssue describes a single problem found by Lint. Problems are found either in one of the
+// instructions being checked, or in the content of a Token.
+type LintIssue struct {
+	Kind     LintKind
+	Severity LintSeverity
+	// Instruction is the 1-based index of the instruction the problem was found in, or zero if it was
+	// found in the Inventory.
+	Instruction int
+	// Category, Token and ID identify the Token the problem was found in. Token is its 0-based
+	// position within the category, or -1 if the problem isn't in a single Token.
+	Category string
+	Token    int
+	ID       string
+	// Position is the byte offset of the problem within the instruction or Token content, and Line
+	// and Column give its 1-based location. They are zero if the problem has no single location.
+	Position int
+	Line     int
+	Column   int
+	// Message describes the problem.
+	Message string
+}
+
+// String describes the issue and where it was found.
+func (l LintIssue) String() string {
+	var where string
+	switch {
+	case l.Instruction > 0:
+		where = fmt.Sprintf("instruction %d", l.Instruction)
+	case l.Token >= 0 && l.ID != "":
+		where = fmt.Sprintf("token %q", l.ID)
+	case l.Token >= 0:
+		where = fmt.Sprintf("%s token %d", l.Category, l.Token)
+	default:
+		where = "inventory"
+	}
+	if l.Line > 0 {
+		where += fmt.Sprintf(":%d:%d", l.Line, l.Column)
+	}
+
+	return fmt.Sprintf("%s: %s: %s", where, l.Severity, l.Message)
+}
+
+// LintOptions configures Lint.
+type LintOptions struct {
+	// Instructions are checked against the Inventory, in addition to the Tokens' own content.
+	Instructions []string
+	// Vars names the State variables which are set before rendering starts.
+	Vars []string
+}
+
+// Lint checks an Inventory, and the instructions which will be rendered with it, for problems which
+// would make rendering fail or produce unexpected output:
+//
+//   - selectors referring to categories with no Tokens
+//   - selectors whose property filters can never match any Token
+//   - variables which are referenced, but never set by SetVars or the initial State
+//   - captures which are referenced, but never made by a selector
+//   - categories which refer to each other, and so can exceed RoundsMax
+//   - unique {repeat} blocks which can run out of Tokens to pick
+//   - Tokens with the same content as another Token in their category
+//   - instructions or Token content which can't be parsed
+//
+// Issues are listed for the instructions in order, followed by the Inventory's categories in name
+// order.
+func Lint(i *Inventory, opts LintOptions) []LintIssue {
+	l := newLinter(i, opts)
+
+	// Captures may be made by any instruction, so find them all first
+	parsed := make([][]node, len(opts.Instructions))
+	errs := make([]error, len(opts.Instructions))
+	for n, src := range opts.Instructions {
+		parsed[n], errs[n] = parse(src)
+		l.addCaptures(parsed[n])
+	}
+
+	for n, src := range opts.Instructions {
+		at := LintIssue{Instruction: n + 1, Token: -1}
+		if errs[n] != nil {
+			syntax := errs[n].(*SyntaxError)
+			l.report(at, LintSyntax, LintError, src, syntax.Position, "%s", syntax.Msg)
+			continue
+		}
+		l.lintNodes(parsed[n], src, at)
+	}
+
+	for _, category := range l.categories {
+		first := make(map[string]int, len(l.dictionary[category]))
+		for idx := range l.dictionary[category] {
+			l.lintToken(category, idx, first)
+		}
+	}
+
+	l.lintCycles()
+
+	return l.issues
+}
+
+// linter holds the state of a Lint run.
+type linter struct {
+	dictionary map[string][]Token
+	categories []string
+	vars       map[string]bool
+	captures   map[string]bool
+	issues     []LintIssue
+}
+
+// newLinter prepares to lint a copy of the Inventory's contents.
+func newLinter(i *Inventory, opts LintOptions) *linter {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	l := &linter{
+		dictionary: make(map[string][]Token, len(i.dictionary)),
+		vars:       make(map[string]bool),
+		captures:   make(map[string]bool),
+	}
+
+	for category, tokens := range i.dictionary {
+		l.dictionary[category] = tokens
+		l.categories = append(l.categories, category)
+		for idx := range tokens {
+			for name := range tokens[idx].SetVars {
+				l.vars[name] = true
+			}
+			nodes, _ := tokenNodes(&tokens[idx])
+			l.addCaptures(nodes)
+		}
+	}
+	sort.Strings(l.categories)
+
+	for _, name := range opts.Vars {
+		l.vars[name] = true
+	}
+
+	return l
+}
+
+// addCaptures records the names of the captures made by selectors within the nodes.
+func (l *linter) addCaptures(nodes []node) {
+	visitNodes(nodes, func(n node) {
+		if s, ok := n.(*selectorNode); ok && s.capture != "" {
+			l.captures[s.capture] = true
+		}
+	})
+}
+
+// report records an issue found at an offset within the source text. The location fields are
+// copied from the template issue.
+func (l *linter) report(at LintIssue, kind LintKind, severity LintSeverity, src string, pos int, format string, args ...interface{}) {
+	at.Kind = kind
+	at.Severity = severity
+	at.Message = fmt.Sprintf(format, args...)
+	if pos >= 0 {
+		at.Position = pos
+		at.Line = 1 + strings.Count(src[:pos], "\n")
+		at.Column = pos - strings.LastIndex(src[:pos], "\n")
+	}
+
+	l.issues = append(l.issues, at)
+}
+
+// lintToken checks the content of a Token, and that no earlier Token in its category has the same
+// content. First maps the content of the category's Tokens checked so far to the first index it was
+// seen at.
+func (l *linter) lintToken(category string, idx int, first map[string]int) {
+	t := &l.dictionary[category][idx]
+	at := LintIssue{Category: category, Token: idx, ID: t.ID}
+
+	if prev, found := first[t.Content]; found {
+		l.report(at, LintDuplicateContent, LintWarning, "", -1, "content %q duplicates %s token %d", t.Content, category, prev)
+	} else {
+		first[t.Content] = idx
+	}
+
+	nodes, err := tokenNodes(t)
+	if err != nil {
+		syntax := err.(*SyntaxError)
+		l.report(at, LintSyntax, LintError, t.Content, syntax.Position, "%s", syntax.Msg)
+		return
+	}
+
+	l.lintNodes(nodes, t.Content, at)
+}
+
+// tokenNodes retrieves the parsed content of a Token. Content without tags has no nodes to check.
+func tokenNodes(t *Token) ([]node, error) {
+	if t.compiled != nil {
+		return t.compiled.nodes, nil
+	}
+	if !hasTags(t.Content) {
+		return nil, nil
+	}
+
+	c, err := Compile(t.Content)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.nodes, nil
+}
+
+// lintNodes checks every selector and variable within the nodes.
+func (l *linter) lintNodes(nodes []node, src string, at LintIssue) {
+	visitNodes(nodes, func(n node) {
+		switch x := n.(type) {
+		case *varNode:
+			if !l.vars[x.name] {
+				l.report(at, LintUnsetVariable, LintWarning, src, x.pos, "variable %q is never set", x.name)
+			}
+		case *refNode:
+			if x.capture && !l.captures[x.name] {
+				l.report(at, LintUnsetCapture, LintError, src, x.pos, "capture %q is never made, so %s always fails", x.name, x.raw)
+			} else if !x.capture && !l.vars[x.name] {
+				l.report(at, LintUnsetVariable, LintError, src, x.pos, "variable %q is never set, so %s always fails", x.name, x.raw)
+			}
+		case *captureNode:
+			if !l.captures[x.name] {
+				l.report(at, LintUnsetCapture, LintWarning, src, x.pos, "capture %q is never made", x.name)
+			}
+		case *ifNode:
+			if !l.vars[x.cond.name] {
+				l.report(at, LintUnsetVariable, LintWarning, src, x.pos, "condition tests variable %q, which is never set", x.cond.name)
+			}
+		case *selectorNode:
+			l.lintSelector(x, src, at)
+		case *repeatNode:
+			if x.unique {
+				l.lintUniqueRepeat(x, src, at)
+			}
+		}
+	})
+}
+
+// lintSelector checks that a selector's category exists and that its filters can match a Token.
+func (l *linter) lintSelector(n *selectorNode, src string, at LintIssue) {
+	if _, found := l.dictionary[n.category]; !found {
+		l.report(at, LintMissingCategory, LintError, src, n.pos, "%s refers to category %q, which has no tokens", n.raw, n.category)
+		return
+	}
+
+	if len(l.candidates(n)) == 0 {
+		l.report(at, LintUnmatchable, LintError, src, n.pos, "%s can never match a token in category %q", n.raw, n.category)
+	}
+}
+
+// candidates finds the Tokens which a selector could match. Filters with fixed values can be
+// checked exactly, while those whose values are rendered can only be checked for the property they
+// need.
+func (l *linter) candidates(n *selectorNode) []*Token {
+	static := newSelector(n.category)
+	var needed []string
+	for _, opt := range n.options {
+		if value, fixed := plainText(opt.value); fixed {
+			static.addOption(opt.key, opt.op, value)
+		} else if opt.op == optTypeRequire {
+			needed = append(needed, opt.key)
+		}
+	}
+
+	var matched []*Token
+	tokens := l.dictionary[n.category]
+	for idx := range tokens {
+		if static.MatchesToken(&tokens[idx]) && hasProperties(&tokens[idx], needed) {
+			matched = append(matched, &tokens[idx])
+		}
+	}
+
+	return matched
+}
+
+// lintUniqueRepeat checks that a unique {repeat} block can't pick more Tokens from any category
+// than its selectors match between them. Only the block's own selectors are counted, not those in
+// the content of the Tokens it picks.
+func (l *linter) lintUniqueRepeat(n *repeatNode, src string, at LintIssue) {
+	picks := make(map[string]int)
+	selectors := make(map[string][]*selectorNode)
+	countPicks(n.body, n.max, picks, selectors)
+
+	categories := make([]string, 0, len(picks))
+	for category := range picks {
+		categories = append(categories, category)
+	}
+	sort.Strings(categories)
+
+	for _, category := range categories {
+		if _, found := l.dictionary[category]; !found {
+			continue
+		}
+
+		pool := make(map[string]bool)
+		for _, s := range selectors[category] {
+			for _, t := range l.candidates(s) {
+				pool[t.identity()] = true
+			}
+		}
+
+		if picks[category] > len(pool) && len(pool) > 0 {
+			l.report(at, LintExhaustedRepeat, LintWarning, src, n.pos,
+				"unique repeat can pick %d tokens from category %q, which has only %d to match, so it can run out", picks[category], category, len(pool))
+		}
+	}
+}
+
+// countPicks finds the most Tokens which the nodes can pick from each category when rendered the
+// given number of times, and collects the selectors for each category.
+func countPicks(nodes []node, times int, picks map[string]int, selectors map[string][]*selectorNode) {
+	for _, n := range nodes {
+		switch x := n.(type) {
+		case *selectorNode:
+			picks[x.category] += times
+			selectors[x.category] = append(selectors[x.category], x)
+			for _, opt := range x.options {
+				countPicks(opt.value, times, picks, selectors)
+			}
+		case *altNode:
+			branches := make([][]node, 0, len(x.choices))
+			for _, c := range x.choices {
+				branches = append(branches, c.nodes)
+			}
+			mostPicks(branches, times, picks, selectors)
+		case *ifNode:
+			mostPicks([][]node{x.then, x.otherwise}, times, picks, selectors)
+		case *repeatNode:
+			countPicks(x.body, times*x.max, picks, selectors)
+		}
+	}
+}
+
+// mostPicks counts the picks made by whichever of several alternative branches picks the most
+// Tokens from each category.
+func mostPicks(branches [][]node, times int, picks map[string]int, selectors map[string][]*selectorNode) {
+	most := make(map[string]int)
+	for _, nodes := range branches {
+		branch := make(map[string]int)
+		countPicks(nodes, times, branch, selectors)
+		for category, count := range branch {
+			if count > most[category] {
+				most[category] = count
+			}
+		}
+	}
+
+	for category, count := range most {
+		picks[category] += count
+	}
+}
+
+// plainText joins nodes which are all literal text. The flag is false if any node isn't text.
+func plainText(nodes []node) (string, bool) {
+	var text strings.Builder
+	for _, n := range nodes {
+		t, ok := n.(*textNode)
+		if !ok {
+			return "", false
+		}
+		text.WriteString(t.text)
+	}
+
+	return text.String(), true
+}
+
+// hasProperties checks that the Token has every one of the properties.
+func hasProperties(t *Token, names []string) bool {
+	for _, name := range names {
+		if _, found := t.Properties[name]; !found {
+			return false
+		}
+	}
+
+	return true
+}
+
+// selectorCategories lists the categories which selectors within the nodes pick from, without
+// duplicates.
+func selectorCategories(nodes []node) []string {
+	seen := make(map[string]bool)
+	var categories []string
+	visitNodes(nodes, func(n node) {
+		if s, ok := n.(*selectorNode); ok && !seen[s.category] {
+			seen[s.category] = true
+			categories = append(categories, s.category)
+		}
+	})
+
+	return categories
+}
+
+// visitNodes calls the function for every node, including those nested within selector options,
+// alternatives, conditional branches and repeated blocks.
+func visitNodes(nodes []node, fn func(n node)) {
+	for _, n := range nodes {
+		fn(n)
+		switch x := n.(type) {
+		case *selectorNode:
+			for _, opt := range x.options {
+				visitNodes(opt.value, fn)
+			}
+		case *altNode:
+			for _, c := range x.choices {
+				visitNodes(c.nodes, fn)
+			}
+		case *ifNode:
+			visitNodes(x.then, fn)
+			visitNodes(x.otherwise, fn)
+		case *repeatNode:
+			visitNodes(x.body, fn)
+		}
+	}
+}
+
+// lintCycles finds groups of categories whose Tokens refer to each other. A group is an error if
+// none of its Tokens can ever be rendered without reaching RoundsMax, and a warning otherwise.
+func (l *linter) lintCycles() {
+	refs := make(map[string]map[string]bool)
+	for _, category := range l.categories {
+		refs[category] = make(map[string]bool)
+		for idx := range l.dictionary[category] {
+			for ref := range tokenRefs(&l.dictionary[category][idx]) {
+				refs[category][ref] = true
+			}
+		}
+	}
+
+	finite := l.finiteCategories()
+
+	for _, group := range stronglyConnected(l.categories, refs) {
+		if len(group) == 1 && !refs[group[0]][group[0]] {
+			continue
+		}
+
+		severity := LintWarning
+		outcome := "may exceed"
+		if !finite[group[0]] {
+			severity = LintError
+			outcome = "always exceeds"
+		}
+
+		at := LintIssue{Category: group[0], Token: -1}
+		if len(group) == 1 {
+			l.report(at, LintCycle, severity, "", -1, "category %q refers to itself, so rendering it %s the maximum depth", group[0], outcome)
+		} else {
+			l.report(at, LintCycle, severity, "", -1, "categories %s refer to each other, so rendering them %s the maximum depth", strings.Join(group, ", "), outcome)
+		}
+	}
+}
+
+// tokenRefs finds the categories referred to by the content of a Token.
+func tokenRefs(t *Token) map[string]bool {
+	refs := make(map[string]bool)
+
+	nodes, _ := tokenNodes(t)
+	visitNodes(nodes, func(n node) {
+		if s, ok := n.(*selectorNode); ok {
+			refs[s.category] = true
+		}
+	})
+
+	return refs
+}
+
+// finiteCategories finds the categories which have at least one Token that can be rendered within
+// a finite depth. References to missing categories don't recurse, so count as finite.
+func (l *linter) finiteCategories() map[string]bool {
+	finite := make(map[string]bool)
+
+	for changed := true; changed; {
+		changed = false
+		for _, category := range l.categories {
+			if finite[category] {
+				continue
+			}
+			for idx := range l.dictionary[category] {
+				nodes, _ := tokenNodes(&l.dictionary[category][idx])
+				if l.nodesFinite(nodes, finite) {
+					finite[category] = true
+					changed = true
+					break
+				}
+			}
+		}
+	}
+
+	return finite
+}
+
+// nodesFinite checks that the nodes can be rendered without referring to a category which isn't
+// finite. Alternations are finite if any of their alternatives is, and conditionals if either branch
+// is, since the branch taken isn't known. Repetitions which may render nothing are always finite.
+func (l *linter) nodesFinite(nodes []node, finite map[string]bool) bool {
+	for _, n := range nodes {
+		switch x := n.(type) {
+		case *selectorNode:
+			if _, exists := l.dictionary[x.category]; exists && !finite[x.category] {
+				return false
+			}
+			for _, opt := range x.options {
+				if !l.nodesFinite(opt.value, finite) {
+					return false
+				}
+			}
+		case *altNode:
+			if !l.anyFinite(x.choices, finite) {
+				return false
+			}
+		case *ifNode:
+			if !l.nodesFinite(x.then, finite) && !l.nodesFinite(x.otherwise, finite) {
+				return false
+			}
+		case *repeatNode:
+			if x.min > 0 && !l.nodesFinite(x.body, finite) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// anyFinite checks if any of the alternatives is finite.
+func (l *linter) anyFinite(choices []choiceNode, finite map[string]bool) bool {
+	for _, c := range choices {
+		if l.nodesFinite(c.nodes, finite) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// stronglyConnected groups the categories into strongly connected components of the reference graph,
+// using Tarjan's algorithm. Each group is sorted, and groups are ordered by their first category.
+func stronglyConnected(categories []string, refs map[string]map[string]bool) [][]string {
+	index := make(map[string]int)
+	low := make(map[string]int)
+	onStack := make(map[string]bool)
+	var stack []string
+	var groups [][]string
+
+	var connect func(c string)
+	connect = func(c string) {
+		index[c] = len(index)
+		low[c] = index[c]
+		stack = append(stack, c)
+		onStack[c] = true
+
+		var targets []string
+		for ref := range refs[c] {
+			targets = append(targets, ref)
+		}
+		sort.Strings(targets)
+
+		for _, ref := range targets {
+			if _, exists := refs[ref]; !exists {
+				continue
+			}
+			if _, visited := index[ref]; !visited {
+				connect(ref)
+				if low[ref] < low[c] {
+					low[c] = low[ref]
+				}
+			} else if onStack[ref] && index[ref] < low[c] {
+				low[c] = index[ref]
+			}
+		}
+
+		if low[c] == index[c] {
+			var group []string
+			for {
+				top := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				onStack[top] = false
+				group = append(group, top)
+				if top == c {
+					break
+				}
+			}
+			sort.Strings(group)
+			groups = append(groups, group)
+		}
+	}
+
+	for _, c := range categories {
+		if _, visited := index[c]; !visited {
+			connect(c)
+		}
+	}
+
+	sort.Slice(groups, func(a, b int) bool {
+		return groups[a][0] < groups[b][0]
+	})
+
+	return groups
+}
@@ -0,0 +1,304 @@
+/*
+ * Copyright 2020 zpxio (Jeff Sharpe)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package generator
+
+import (
+	"github.com/stretchr/testify/suite"
+	"testing"
+)
+
+type LintSuite struct {
+	suite.Suite
+}
+
+func TestLintSuite(t *testing.T) {
+	suite.Run(t, new(LintSuite))
+}
+
+// lintKinds lists the kinds of the issues, in order.
+func lintKinds(issues []LintIssue) []LintKind {
+	kinds := make([]LintKind, 0, len(issues))
+	for _, issue := range issues {
+		kinds = append(kinds, issue.Kind)
+	}
+
+	return kinds
+}
+
+func (s *LintSuite) TestLint_Clean() {
+	i := BuildSampleInventory()
+
+	issues := Lint(i, LintOptions{Instructions: []string{"A [Description:tone=negative] [Animal:type=[AnimalType]]"}})
+
+	s.Empty(issues)
+}
+
+func (s *LintSuite) TestLint_MissingCategory() {
+	i := BuildSampleInventory()
+
+	issues := Lint(i, LintOptions{Instructions: []string{"A big\n[Animal] and [Plant]"}})
+
+	s.Require().Len(issues, 1)
+	s.Equal(LintMissingCategory, issues[0].Kind)
+	s.Equal(LintError, issues[0].Severity)
+	s.Equal(1, issues[0].Instruction)
+	s.Equal(-1, issues[0].Token)
+	s.Equal(19, issues[0].Position)
+	s.Equal(2, issues[0].Line)
+	s.Equal(14, issues[0].Column)
+	s.Equal(`instruction 1:2:14: error: [Plant] refers to category "Plant", which has no tokens`, issues[0].String())
+}
+
+func (s *LintSuite) TestLint_MissingCategoryInToken() {
+	i := BuildSampleInventory()
+	t := BuildToken("Animal", "[Colour] Dodo", 1.0, Properties{})
+	t.ID = "dodo"
+	i.Add(t)
+
+	issues := Lint(i, LintOptions{})
+
+	s.Require().Len(issues, 1)
+	s.Equal(LintMissingCategory, issues[0].Kind)
+	s.Equal(0, issues[0].Instruction)
+	s.Equal("Animal", issues[0].Category)
+	s.Equal(4, issues[0].Token)
+	s.Equal("dodo", issues[0].ID)
+	s.Equal(`token "dodo":1:1: error: [Colour] refers to category "Colour", which has no tokens`, issues[0].String())
+}
+
+func (s *LintSuite) TestLint_Unmatchable() {
+	i := BuildSampleInventory()
+
+	issues := Lint(i, LintOptions{Instructions: []string{
+		"[Animal:type=fish,env=ground]",
+		"[Animal:type=fish,env!=water]",
+		"[Animal:colour]",
+		"[Animal:type=fish,env=water]",
+	}})
+
+	s.Equal([]LintKind{LintUnmatchable, LintUnmatchable, LintUnmatchable}, lintKinds(issues))
+	s.Equal(1, issues[0].Instruction)
+	s.Equal(2, issues[1].Instruction)
+	s.Equal(3, issues[2].Instruction)
+	s.Equal(`[Animal:colour] can never match a token in category "Animal"`, issues[2].Message)
+}
+
+func (s *LintSuite) TestLint_UnmatchableDynamic() {
+	i := BuildSampleInventory()
+
+	// Rendered values can't be checked, but the property must still exist
+	issues := Lint(i, LintOptions{
+		Instructions: []string{"[Animal:type=[$type]]", "[Animal:colour=[$type]]"},
+		Vars:         []string{"type"},
+	})
+
+	s.Require().Len(issues, 1)
+	s.Equal(LintUnmatchable, issues[0].Kind)
+	s.Equal(2, issues[0].Instruction)
+}
+
+func (s *LintSuite) TestLint_UnsetVariable() {
+	i := BuildSampleInventory()
+	t := BuildToken("Plant", "Fern", 1.0, Properties{})
+	t.OnRenderSet("size", "small")
+	i.Add(t)
+
+	issues := Lint(i, LintOptions{
+		Instructions: []string{"[$size] [$name] [Animal:type=[$kind]] [$colour]"},
+		Vars:         []string{"name"},
+	})
+
+	s.Equal([]LintKind{LintUnsetVariable, LintUnsetVariable}, lintKinds(issues))
+	s.Equal(LintWarning, issues[0].Severity)
+	s.Equal(`variable "kind" is never set`, issues[0].Message)
+	s.Equal(29, issues[0].Position)
+	s.Equal(`variable "colour" is never set`, issues[1].Message)
+}
+
+func (s *LintSuite) TestLint_Cycle() {
+	i := BuildSampleInventory()
+	i.AddToken("Loop", "a [Loop]", 1.0, Properties{})
+	i.AddToken("Ping", "[Pong]", 1.0, Properties{})
+	i.AddToken("Pong", "[Ping]", 1.0, Properties{})
+	i.AddToken("Pong", "end", 1.0, Properties{})
+
+	issues := Lint(i, LintOptions{})
+
+	s.Equal([]LintKind{LintCycle, LintCycle}, lintKinds(issues))
+	s.Equal(LintError, issues[0].Severity)
+	s.Equal("Loop", issues[0].Category)
+	s.Equal(`category "Loop" refers to itself, so rendering it always exceeds the maximum depth`, issues[0].Message)
+	s.Equal(LintWarning, issues[1].Severity)
+	s.Equal("Ping", issues[1].Category)
+	s.Equal(`categories Ping, Pong refer to each other, so rendering them may exceed the maximum depth`, issues[1].Message)
+}
+
+func (s *LintSuite) TestLint_CycleAlternation() {
+	i := CreateInventory()
+	i.AddToken("Loop", "{again [Loop]|done}", 1.0, Properties{})
+	i.AddToken("Stuck", "{a [Stuck]|b [Stuck]} [$x]", 1.0, Properties{})
+
+	issues := Lint(i, LintOptions{Vars: []string{"x"}})
+
+	s.Equal([]LintKind{LintCycle, LintCycle}, lintKinds(issues))
+	s.Equal(LintWarning, issues[0].Severity)
+	s.Equal("Loop", issues[0].Category)
+	s.Equal(LintError, issues[1].Severity)
+	s.Equal("Stuck", issues[1].Category)
+}
+
+func (s *LintSuite) TestLint_Alternation() {
+	i := BuildSampleInventory()
+
+	issues := Lint(i, LintOptions{Instructions: []string{"{[Plant]|[Animal:type={bird|fish}]} {[$x]|y}"}})
+
+	s.Equal([]LintKind{LintMissingCategory, LintUnsetVariable}, lintKinds(issues))
+}
+
+func (s *LintSuite) TestLint_Conditional() {
+	i := BuildSampleInventory()
+	t := BuildToken("Hero", "Alice", 1.0, Properties{})
+	t.OnRenderSet("gender", "female")
+	i.Add(t)
+	i.AddToken("Loop", "{if $gender}[Loop]{else}done{end}", 1.0, Properties{})
+
+	issues := Lint(i, LintOptions{Instructions: []string{"{if $gender=female}[Plant]{end}{if !$title}x{end}"}})
+
+	s.Equal([]LintKind{LintMissingCategory, LintUnsetVariable, LintCycle}, lintKinds(issues))
+	s.Equal(`condition tests variable "title", which is never set`, issues[1].Message)
+	s.Equal(31, issues[1].Position)
+	s.Equal(LintWarning, issues[2].Severity)
+}
+
+func (s *LintSuite) TestLint_Repeat() {
+	i := BuildSampleInventory()
+	i.AddToken("List", "{repeat 0..2}[List]{end}", 1.0, Properties{})
+	i.AddToken("Chain", "{repeat 1..2}[Chain]{end}", 1.0, Properties{})
+
+	issues := Lint(i, LintOptions{Instructions: []string{"{repeat 2}[$x] [Plant]{end}"}})
+
+	s.Equal([]LintKind{LintUnsetVariable, LintMissingCategory, LintCycle, LintCycle}, lintKinds(issues))
+	s.Equal("Chain", issues[2].Category)
+	s.Equal(LintError, issues[2].Severity)
+	s.Equal("List", issues[3].Category)
+	s.Equal(LintWarning, issues[3].Severity)
+}
+
+func (s *LintSuite) TestLint_UniqueRepeat() {
+	i := BuildSampleInventory()
+
+	issues := Lint(i, LintOptions{Instructions: []string{
+		`{repeat 1..2 unique}[Description:tone=positive]{end}`,
+		`{repeat 2 unique}[Description:tone=negative]{end} {repeat 4 unique}[Description]{end}`,
+		`{repeat 3 unique}[Animal:type=mammal] {[Animal]|x}{end}`,
+		`{repeat 2 unique}{repeat 2}[AnimalType]{end}{end}`,
+		`{repeat 3 unique}{[Animal:type=mammal]|[Animal:type=fish]}{end}`,
+	}})
+
+	s.Equal([]LintKind{LintExhaustedRepeat, LintExhaustedRepeat, LintExhaustedRepeat}, lintKinds(issues))
+	s.Equal(1, issues[0].Instruction)
+	s.Equal(LintWarning, issues[0].Severity)
+	s.Equal(`unique repeat can pick 2 tokens from category "Description", which has only 1 to match, so it can run out`, issues[0].Message)
+	s.Equal(3, issues[1].Instruction)
+	s.Equal(4, issues[2].Instruction)
+}
+
+func (s *LintSuite) TestLint_Capture() {
+	i := BuildSampleInventory()
+	i.AddToken("Scene", "[Animal#hero] and [#sidekick]", 1.0, Properties{})
+
+	issues := Lint(i, LintOptions{Instructions: []string{"[Scene] [#hero.family]", "[#villain] [Animal#villain]"}})
+
+	s.Equal([]LintKind{LintUnsetCapture}, lintKinds(issues))
+	s.Equal("Scene", issues[0].Category)
+	s.Equal(`capture "sidekick" is never made`, issues[0].Message)
+	s.Equal(LintWarning, issues[0].Severity)
+}
+
+func (s *LintSuite) TestLint_References() {
+	i := BuildSampleInventory()
+
+	issues := Lint(i, LintOptions{
+		Instructions: []string{"[Animal#a] [Animal:family=#a.family,env=$env]", "[Animal:type=#b,colour=$env]"},
+		Vars:         []string{"env"},
+	})
+
+	s.Equal([]LintKind{LintUnmatchable, LintUnsetCapture}, lintKinds(issues))
+	s.Equal(LintError, issues[1].Severity)
+	s.Equal(2, issues[1].Instruction)
+	s.Equal(`capture "b" is never made, so #b always fails`, issues[1].Message)
+
+	issues = Lint(i, LintOptions{Instructions: []string{"[Animal:env=$env]"}})
+
+	s.Equal([]LintKind{LintUnsetVariable}, lintKinds(issues))
+	s.Equal(LintError, issues[0].Severity)
+}
+
+func (s *LintSuite) TestLint_CycleThroughMissing() {
+	i := CreateInventory()
+	i.AddToken("Loop", "[Loop] [Gone]", 1.0, Properties{})
+	i.AddToken("Loop", "[Gone]", 1.0, Properties{})
+
+	issues := Lint(i, LintOptions{})
+
+	// A missing category fails rendering rather than recursing
+	s.Equal([]LintKind{LintMissingCategory, LintMissingCategory, LintCycle}, lintKinds(issues))
+	s.Equal(LintWarning, issues[2].Severity)
+}
+
+func (s *LintSuite) TestLint_DuplicateContent() {
+	i := BuildSampleInventory()
+	i.AddToken("Animal", "Capybara", 1.0, Properties{"type": "mammal"})
+	i.AddToken("Description", "Capybara", 1.0, Properties{})
+
+	issues := Lint(i, LintOptions{})
+
+	s.Require().Len(issues, 1)
+	s.Equal(LintDuplicateContent, issues[0].Kind)
+	s.Equal(LintWarning, issues[0].Severity)
+	s.Equal(4, issues[0].Token)
+	s.Equal(`Animal token 4: warning: content "Capybara" duplicates Animal token 2`, issues[0].String())
+}
+
+func (s *LintSuite) TestLint_Syntax() {
+	i := BuildSampleInventory()
+	i.AddToken("Plant", "[Oak", 1.0, Properties{})
+
+	issues := Lint(i, LintOptions{Instructions: []string{"[Animal", "[Animal]"}})
+
+	s.Equal([]LintKind{LintSyntax, LintSyntax}, lintKinds(issues))
+	s.Equal(1, issues[0].Instruction)
+	s.Equal(LintError, issues[0].Severity)
+	s.Equal("Plant", issues[1].Category)
+}
+
+func (s *LintSuite) TestLintKind_String() {
+	s.Equal("missing category", LintMissingCategory.String())
+	s.Equal("cycle", LintCycle.String())
+	s.Equal("unset capture", LintUnsetCapture.String())
+	s.Equal("exhausted repeat", LintExhaustedRepeat.String())
+	s.Equal("unknown", LintKind(99).String())
+}
+
+func BenchmarkLint_Large(b *testing.B) {
+	i := buildLargeInventory(50000)
+	b.ResetTimer()
+
+	for n := 0; n < b.N; n++ {
+		Lint(i, LintOptions{})
+	}
+}
@@ -0,0 +1,396 @@
+/*
+ * Copyright 2020 zpxio (Jeff Sharpe)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package generator
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// IssueKind identifies the type of problem found with an inventory entry.
+type IssueKind int
+
+const (
+	// IssueMissingCategory means the entry has no category. The entry is rejected.
+	IssueMissingCategory IssueKind = iota
+	// IssueMissingContent means the entry has no content. The entry is rejected.
+	IssueMissingContent
+	// IssueUnknownField means the entry has a field which isn't part of a Token. The field is ignored.
+	IssueUnknownField
+	// IssueInvalidRarity means the rarity isn't a positive number. The rarity is set to 1.0.
+	IssueInvalidRarity
+	// IssueInvalidValue means a field has the wrong type of value. The entry is rejected.
+	IssueInvalidValue
+	// IssueDuplicateID means the entry has the same ID as an earlier entry in the file. The entry is
+	// rejected.
+	IssueDuplicateID
+)
+
+// String describes the IssueKind.
+func (k IssueKind) String() string {
+	switch k {
+	case IssueMissingCategory:
+		return "missing category"
+	case IssueMissingContent:
+		return "missing content"
+	case IssueUnknownField:
+		return "unknown field"
+	case IssueInvalidRarity:
+		return "invalid rarity"
+	case IssueInvalidValue:
+		return "invalid value"
+	case IssueDuplicateID:
+		return "duplicate ID"
+	}
+
+	return "unknown issue"
+}
+
+// LoadIssue describes a problem with a single entry found while loading an inventory.
+type LoadIssue struct {
+	// File is the file the entry was loaded from.
+	File string
+	// Line and Column give the 1-based location of the problem, or zero if it isn't known.
+	Line   int
+	Column int
+	// Entry is the 0-based position of the entry within the file.
+	Entry int
+	// Kind identifies the problem, and Field names the field involved, if any.
+	Kind  IssueKind
+	Field string
+	// Message describes the problem.
+	Message string
+	// Rejected is true if the entry was not added to the Inventory because of this problem.
+	Rejected bool
+}
+
+// String formats the LoadIssue with its location, in the style of a compiler message.
+func (e LoadIssue) String() string {
+	location := e.File
+	if e.Line > 0 {
+		location += fmt.Sprintf(":%d:%d", e.Line, e.Column)
+	}
+
+	action := "warning"
+	if e.Rejected {
+		action = "rejected"
+	}
+
+	return fmt.Sprintf("%s: entry %d %s: %s", location, e.Entry, action, e.Message)
+}
+
+// LoadOptions configures how inventory files are loaded.
+type LoadOptions struct {
+	// Strict causes loading to fail if any entry has a problem, rather than skipping bad entries.
+	// Nothing is added to the Inventory from a file that fails strict validation.
+	Strict bool
+	// Format is the format of the inventory files. By default, it is detected from file extensions.
+	Format Format
+}
+
+// LoadReport describes the outcome of loading one or more inventory files.
+type LoadReport struct {
+	// Loaded is the number of Tokens added to the Inventory.
+	Loaded int
+	// Issues lists every problem found, in file order.
+	Issues []LoadIssue
+	// Files lists every file read, including those included by manifests, in the order they were
+	// read.
+	Files []string
+}
+
+// Rejected returns the issues which caused an entry to be rejected.
+func (r *LoadReport) Rejected() []LoadIssue {
+	var rejected []LoadIssue
+	for _, issue := range r.Issues {
+		if issue.Rejected {
+			rejected = append(rejected, issue)
+		}
+	}
+
+	return rejected
+}
+
+// ValidationError is returned when strict loading finds problems with an inventory.
+type ValidationError struct {
+	Report *LoadReport
+}
+
+// Error summarizes the problems found.
+func (e *ValidationError) Error() string {
+	if len(e.Report.Issues) == 0 {
+		return "inventory failed validation"
+	}
+
+	return fmt.Sprintf("inventory has %d problem(s); first: %s", len(e.Report.Issues), e.Report.Issues[0])
+}
+
+// position is a 1-based line and column within a source file.
+type position struct {
+	line   int
+	column int
+}
+
+// entry is a single Token definition read from an inventory file, before it has been validated.
+// Values are held in the generic form produced by decoding YAML or JSON. Entries which aren't maps
+// have nil fields.
+type entry struct {
+	index    int
+	pos      position
+	fields   map[string]interface{}
+	fieldPos map[string]position
+}
+
+// fieldPosition finds the position of a field, falling back to the position of the entry.
+func (e *entry) fieldPosition(field string) position {
+	if p, ok := e.fieldPos[field]; ok {
+		return p
+	}
+
+	return e.pos
+}
+
+// tokenFields lists the fields which make up a Token definition.
+var tokenFields = map[string]bool{
+	"id":         true,
+	"category":   true,
+	"content":    true,
+	"rarity":     true,
+	"properties": true,
+	"setvars":    true,
+}
+
+// validate converts an entry into a normalized Token, reporting any problems found. The returned
+// flag is false if the entry must be rejected.
+func (e *entry) validate(file string) (Token, []LoadIssue, bool) {
+	var issues []LoadIssue
+	valid := true
+
+	report := func(kind IssueKind, field string, rejected bool, format string, args ...interface{}) {
+		p := e.fieldPosition(field)
+		issues = append(issues, LoadIssue{
+			File:     file,
+			Line:     p.line,
+			Column:   p.column,
+			Entry:    e.index,
+			Kind:     kind,
+			Field:    field,
+			Message:  fmt.Sprintf(format, args...),
+			Rejected: rejected,
+		})
+		if rejected {
+			valid = false
+		}
+	}
+
+	if e.fields == nil {
+		report(IssueInvalidValue, "", true, "entry is not a token definition")
+		return Token{}, issues, false
+	}
+
+	// Report unknown fields in a stable order
+	var names []string
+	for name := range e.fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if !tokenFields[name] {
+			report(IssueUnknownField, name, false, "unknown field %q", name)
+		}
+	}
+
+	t := BuildToken("", "", 0, Properties{})
+
+	if v, ok := e.fields["id"]; ok {
+		s, isScalar := scalarString(v)
+		if !isScalar {
+			report(IssueInvalidValue, "id", true, "id must be text")
+		}
+		t.ID = s
+	}
+
+	if v, ok := e.fields["category"]; ok {
+		s, isScalar := scalarString(v)
+		if !isScalar {
+			report(IssueInvalidValue, "category", true, "category must be text")
+		}
+		t.Category = s
+	}
+	if strings.TrimSpace(t.Category) == "" {
+		report(IssueMissingCategory, "category", true, "missing category")
+	}
+
+	if v, ok := e.fields["content"]; ok {
+		s, isScalar := scalarString(v)
+		if !isScalar {
+			report(IssueInvalidValue, "content", true, "content must be text")
+		}
+		t.Content = s
+	}
+	if t.Content == "" {
+		report(IssueMissingContent, "content", true, "missing content")
+	}
+
+	if v, ok := e.fields["rarity"]; ok && v != nil {
+		r, isNumber := numberValue(v)
+		if !isNumber || r <= 0.0 {
+			report(IssueInvalidRarity, "rarity", false, "rarity %v is not a positive number; using 1.0", v)
+			r = 1.0
+		}
+		t.Rarity = r
+	}
+
+	for _, field := range []string{"properties", "setvars"} {
+		v, ok := e.fields[field]
+		if !ok || v == nil {
+			continue
+		}
+
+		values, isMap := stringMap(v)
+		if !isMap {
+			report(IssueInvalidValue, field, true, "%s must be a map of names to text values", field)
+			continue
+		}
+
+		if field == "properties" {
+			t.Properties = values
+		} else {
+			t.SetVars = values
+		}
+	}
+
+	t.Normalize()
+
+	// Report issues in the order they appear in the file
+	sort.SliceStable(issues, func(a, b int) bool {
+		if issues[a].Line != issues[b].Line {
+			return issues[a].Line < issues[b].Line
+		}
+		return issues[a].Column < issues[b].Column
+	})
+
+	return t, issues, valid
+}
+
+// scalarString converts a scalar value to text. The flag is false if the value isn't a scalar.
+func scalarString(v interface{}) (string, bool) {
+	switch x := v.(type) {
+	case nil:
+		return "", true
+	case string:
+		return x, true
+	case json.Number:
+		return x.String(), true
+	case bool, int, int64, uint64, float64:
+		return fmt.Sprint(x), true
+	}
+
+	return "", false
+}
+
+// numberValue converts a numeric value, or text containing a number, to a float64.
+func numberValue(v interface{}) (float64, bool) {
+	switch x := v.(type) {
+	case int:
+		return float64(x), true
+	case int64:
+		return float64(x), true
+	case uint64:
+		return float64(x), true
+	case float64:
+		return x, true
+	case json.Number:
+		f, err := x.Float64()
+		return f, err == nil
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(x), 64)
+		return f, err == nil
+	}
+
+	return 0, false
+}
+
+// stringMap converts a map of scalar values to a map of text values.
+func stringMap(v interface{}) (map[string]string, bool) {
+	result := make(map[string]string)
+
+	switch x := v.(type) {
+	case map[string]interface{}:
+		for k, val := range x {
+			s, ok := scalarString(val)
+			if !ok {
+				return nil, false
+			}
+			result[k] = s
+		}
+	case map[interface{}]interface{}:
+		for k, val := range x {
+			s, ok := scalarString(val)
+			if !ok {
+				return nil, false
+			}
+			result[fmt.Sprint(k)] = s
+		}
+	default:
+		return nil, false
+	}
+
+	return result, true
+}
+
+// validateEntries validates every entry read from a file, returning the valid Tokens along with the
+// problems found. Entries which reuse the ID of an earlier entry are rejected.
+func validateEntries(file string, entries []entry) ([]Token, []LoadIssue) {
+	var tokens []Token
+	var issues []LoadIssue
+	ids := make(map[string]int)
+
+	for idx := range entries {
+		e := &entries[idx]
+		t, entryIssues, valid := e.validate(file)
+		issues = append(issues, entryIssues...)
+
+		if valid && t.ID != "" {
+			if first, taken := ids[t.ID]; taken {
+				p := e.fieldPosition("id")
+				issues = append(issues, LoadIssue{
+					File:     file,
+					Line:     p.line,
+					Column:   p.column,
+					Entry:    e.index,
+					Kind:     IssueDuplicateID,
+					Field:    "id",
+					Message:  fmt.Sprintf("id %q is already used by entry %d", t.ID, first),
+					Rejected: true,
+				})
+				valid = false
+			} else {
+				ids[t.ID] = e.index
+			}
+		}
+
+		if valid {
+			tokens = append(tokens, t)
+		}
+	}
+
+	return tokens, issues
+}
@@ -0,0 +1,154 @@
+/*
+ * Copyright 2020 zpxio (Jeff Sharpe)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package generator
+
+import (
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/suite"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type LoadSuite struct {
+	suite.Suite
+}
+
+func TestLoadSuite(t *testing.T) {
+	suite.Run(t, new(LoadSuite))
+}
+
+func (s *LoadSuite) TestLoadWithReport_Clean() {
+	i := CreateInventory()
+
+	report, err := i.LoadWithReport(filepath.Join(DataDir(), "inv_animals.yml"), LoadOptions{Strict: true})
+
+	s.NoError(err)
+	s.Equal(11, report.Loaded)
+	s.Empty(report.Issues)
+}
+
+func (s *LoadSuite) TestLoadWithReport_PartiallyBad() {
+	testFile := filepath.Join(DataDir(), "partially_bad.yml")
+	i := CreateInventory()
+
+	report, err := i.LoadWithReport(testFile, LoadOptions{})
+
+	s.NoError(err)
+	s.Equal(7, report.Loaded)
+
+	rejected := report.Rejected()
+	s.Require().Len(rejected, 8)
+	s.Equal(LoadIssue{File: testFile, Line: 30, Column: 3, Entry: 4, Kind: IssueMissingContent, Field: "content", Message: "missing content", Rejected: true}, rejected[0])
+	s.Equal(LoadIssue{File: testFile, Line: 36, Column: 3, Entry: 5, Kind: IssueMissingCategory, Field: "category", Message: "missing category", Rejected: true}, rejected[1])
+	s.Equal(IssueMissingCategory, rejected[2].Kind)
+	s.Equal(IssueMissingContent, rejected[3].Kind)
+	s.Equal(6, rejected[3].Entry)
+
+	unknown := report.Issues[2]
+	s.Equal(IssueUnknownField, unknown.Kind)
+	s.Equal("name", unknown.Field)
+	s.Equal(42, unknown.Line)
+	s.False(unknown.Rejected)
+	s.Equal(testFile+`:42:3: entry 6 warning: unknown field "name"`, unknown.String())
+}
+
+func (s *LoadSuite) TestLoadWithReport_Strict() {
+	i := CreateInventory()
+
+	report, err := i.LoadWithReport(filepath.Join(DataDir(), "partially_bad.yml"), LoadOptions{Strict: true})
+
+	s.Require().Error(err)
+	s.IsType(&ValidationError{}, err)
+	s.Contains(err.Error(), "inventory has 17 problem(s); first: ")
+	s.Equal(0, report.Loaded)
+	s.Len(report.Issues, 17)
+	s.Empty(i.dictionary)
+}
+
+func (s *LoadSuite) TestLoadWithReport_Values() {
+	i := CreateInventory()
+
+	report, err := i.LoadWithReport(filepath.Join(DataDir(), "issues.yml"), LoadOptions{})
+
+	s.NoError(err)
+	s.Equal(3, report.Loaded)
+
+	kinds := []IssueKind{}
+	for _, issue := range report.Issues {
+		kinds = append(kinds, issue.Kind)
+	}
+	s.Equal([]IssueKind{IssueInvalidRarity, IssueInvalidRarity, IssueUnknownField, IssueInvalidValue, IssueMissingCategory, IssueInvalidValue}, kinds)
+	s.Equal(15, report.Issues[5].Line)
+
+	animals := i.dictionary["Animal"]
+	s.Require().Len(animals, 3)
+	s.Equal(1.0, animals[0].Rarity)
+	s.Equal(1.0, animals[1].Rarity)
+	s.Equal(0.5, animals[2].Rarity)
+	s.Equal(Properties{"extinct": "true", "legs": "2"}, Properties(animals[2].Properties))
+	s.Equal("extinct", animals[2].SetVars["status"])
+}
+
+func (s *LoadSuite) TestIssueKindString() {
+	s.Equal("missing category", IssueMissingCategory.String())
+	s.Equal("invalid value", IssueInvalidValue.String())
+	s.Equal("duplicate ID", IssueDuplicateID.String())
+	s.Equal("unknown issue", IssueKind(99).String())
+}
+
+func (s *LoadSuite) TestLoadWithReport_IDs() {
+	testFile := filepath.Join(DataDir(), "inv_ids.yml")
+	i := CreateInventory()
+
+	report, err := i.LoadWithReport(testFile, LoadOptions{})
+
+	s.NoError(err)
+	s.Equal(3, report.Loaded)
+	s.Require().Len(report.Issues, 2)
+	s.Equal(LoadIssue{File: testFile, Line: 17, Column: 3, Entry: 3, Kind: IssueDuplicateID, Field: "id", Message: `id "animal-aardvark" is already used by entry 0`, Rejected: true}, report.Issues[0])
+	s.Equal(IssueInvalidValue, report.Issues[1].Kind)
+	s.Equal("id", report.Issues[1].Field)
+
+	aardvark, found := i.Get("animal-aardvark")
+	s.True(found)
+	s.Equal("Aardvark", aardvark.Content)
+	s.Equal([]string{"Aardvark", "Capybara", "Boomalope"}, contents(i, "Animal"))
+}
+
+func (s *LoadSuite) TestLoad_IDAlreadyInInventory() {
+	i := CreateInventory()
+	t := BuildToken("Animal", "Tapir", 1.0, Properties{})
+	t.ID = "animal-capybara"
+	i.Add(t)
+
+	err := i.Load(filepath.Join(DataDir(), "inv_ids.yml"))
+
+	s.Require().Error(err)
+	s.True(errors.Is(err, ErrDuplicateID))
+	s.Equal([]string{"Tapir"}, contents(i, "Animal"))
+}
+
+func (s *LoadSuite) TestLoad_Frozen() {
+	i := CreateInventory()
+	i.Freeze()
+
+	s.Equal(ErrFrozen, errors.Cause(i.Load(filepath.Join(DataDir(), "inv_animals.yml"))))
+	s.Equal(ErrFrozen, errors.Cause(i.LoadPaths([]string{filepath.Join(DataDir(), "inv_animals.*")})))
+	s.Equal(ErrFrozen, errors.Cause(i.LoadReader(strings.NewReader("- category: Animal\n  content: Okapi\n"), FormatYAML)))
+	s.Empty(i.Tokens())
+}
@@ -0,0 +1,306 @@
+/*
+ * Copyright 2020 zpxio (Jeff Sharpe)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package generator
+
+import (
+	"github.com/pkg/errors"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Manifest settings
+const (
+	manifestTokens  = "tokens"
+	manifestInclude = "include"
+	manifestMode    = "mode"
+	manifestRemove  = "remove"
+	manifestScale   = "scale"
+)
+
+// manifest holds the settings of an inventory manifest.
+type manifest struct {
+	include []string
+	policy  MergePolicy
+}
+
+// readManifest validates the settings of a manifest. Plain inventories have no settings, and
+// produce an empty manifest.
+func readManifest(settings map[string]interface{}) (*manifest, error) {
+	m := &manifest{}
+
+	var names []string
+	for name := range settings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		value := settings[name]
+
+		switch name {
+		case manifestInclude:
+			include, ok := stringList(value)
+			if !ok {
+				return nil, errors.New("include must be a list of file names")
+			}
+			m.include = include
+		case manifestMode:
+			mode, _ := scalarString(value)
+			parsed, err := ParseMergeMode(mode)
+			if err != nil {
+				return nil, err
+			}
+			m.policy.Mode = parsed
+		case manifestRemove:
+			remove, ok := stringList(value)
+			if !ok {
+				return nil, errors.New("remove must be a list of selectors")
+			}
+			for _, src := range remove {
+				s, err := CompileSelector(strings.TrimSpace(src))
+				if err != nil {
+					return nil, errors.Wrapf(err, "invalid selector %q", src)
+				}
+				m.policy.Remove = append(m.policy.Remove, s)
+			}
+		case manifestScale:
+			scale, ok := value.(map[string]interface{})
+			if !ok {
+				return nil, errors.New("scale must be a map of categories to factors")
+			}
+			m.policy.Scale = make(map[string]float64)
+			for category, v := range scale {
+				factor, isNumber := numberValue(v)
+				if !isNumber || !(factor > 0) {
+					return nil, errors.Errorf("scale factor %v for %s must be a positive number", v, category)
+				}
+				m.policy.Scale[category] = factor
+			}
+		default:
+			return nil, errors.Errorf("unknown manifest setting %q", name)
+		}
+	}
+
+	return m, nil
+}
+
+// stringList converts a generic list of scalars to a list of strings. A single scalar is treated as
+// a list of one.
+func stringList(v interface{}) ([]string, bool) {
+	if s, ok := v.(string); ok {
+		return []string{s}, true
+	}
+
+	list, ok := v.([]interface{})
+	if !ok {
+		return nil, false
+	}
+
+	result := make([]string, 0, len(list))
+	for _, item := range list {
+		s, isScalar := scalarString(item)
+		if !isScalar || s == "" {
+			return nil, false
+		}
+		result = append(result, s)
+	}
+
+	return result, true
+}
+
+// layer is a validated inventory file, ready to be merged into an Inventory after the layers of the
+// files it includes.
+type layer struct {
+	name     string
+	includes []*layer
+	tokens   []Token
+	policy   MergePolicy
+}
+
+// apply merges the layer into the Inventory after its included layers, returning the number of
+// Tokens merged. The caller must hold the Inventory's write lock.
+func (l *layer) apply(i *Inventory) (int, error) {
+	count := 0
+	for _, inc := range l.includes {
+		n, err := inc.apply(i)
+		if err != nil {
+			return count, err
+		}
+		count += n
+	}
+
+	if err := i.mergeLocked(l.tokens, l.policy); err != nil {
+		return count, errors.Wrapf(err, "Failed to merge %s", l.name)
+	}
+
+	return count + len(l.tokens), nil
+}
+
+// fileSource reads inventory files for a loader.
+type fileSource interface {
+	fs.FS
+
+	// resolve finds the path of an included file, relative to the file which includes it.
+	resolve(from string, name string) string
+}
+
+// dirSource reads inventory files from an fs.FS, resolving included paths within it.
+type dirSource struct {
+	fs.FS
+}
+
+func (d dirSource) resolve(from string, name string) string {
+	return path.Join(path.Dir(from), name)
+}
+
+// osSource reads inventory files from the operating system. Unlike the file systems created by
+// os.DirFS, it accepts any path which the operating system does, including absolute paths and paths
+// which start with "..".
+type osSource struct{}
+
+func (osSource) Open(name string) (fs.File, error) {
+	return os.Open(name)
+}
+
+func (osSource) Glob(pattern string) ([]string, error) {
+	return filepath.Glob(pattern)
+}
+
+func (osSource) resolve(from string, name string) string {
+	if filepath.IsAbs(name) {
+		return name
+	}
+
+	return filepath.Join(filepath.Dir(from), filepath.FromSlash(name))
+}
+
+// loader reads and validates inventory files, following the includes of manifests. Nothing is added
+// to an Inventory until every file has been read, so that loading can fail without leaving the
+// Inventory partially changed.
+type loader struct {
+	source fileSource
+	report *LoadReport
+	open   []string
+}
+
+// newLoader creates a loader which reads files from the source. A nil source means that included
+// files can't be read.
+func newLoader(source fileSource) *loader {
+	return &loader{source: source, report: &LoadReport{}}
+}
+
+// loadFile reads and validates an inventory file and the files it includes.
+func (l *loader) loadFile(name string, format Format) (*layer, error) {
+	for _, open := range l.open {
+		if open == name {
+			return nil, errors.Errorf("include cycle: %s", strings.Join(append(l.open, name), " -> "))
+		}
+	}
+
+	data, err := fs.ReadFile(l.source, name)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to read inventory file %s.", name)
+	}
+	l.report.Files = append(l.report.Files, name)
+
+	return l.load(name, data, format)
+}
+
+// load validates inventory data and the files it includes. The name is used to detect the format
+// when it isn't given, to label issues, and to resolve included files.
+func (l *loader) load(name string, data []byte, format Format) (*layer, error) {
+	if format == FormatAuto {
+		format = FormatForPath(name)
+	}
+
+	doc, err := readDocument(data, format)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to parse %s file %s", format, name)
+	}
+
+	m, err := readManifest(doc.settings)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Invalid manifest %s", name)
+	}
+
+	result := &layer{name: name, policy: m.policy}
+
+	if len(m.include) > 0 {
+		if l.source == nil {
+			return nil, errors.Errorf("%s includes other files, which can't be read when loading from a stream", name)
+		}
+
+		l.open = append(l.open, name)
+		for _, pattern := range m.include {
+			paths, err := findInventoryFiles(l.source, l.source.resolve(name, pattern))
+			if err != nil {
+				return nil, errors.Wrapf(err, "%s", name)
+			}
+
+			for _, p := range paths {
+				inc, err := l.loadFile(p, FormatAuto)
+				if err != nil {
+					return nil, err
+				}
+				result.includes = append(result.includes, inc)
+			}
+		}
+		l.open = l.open[:len(l.open)-1]
+	}
+
+	tokens, issues := validateEntries(name, doc.entries)
+	result.tokens = tokens
+	l.report.Issues = append(l.report.Issues, issues...)
+
+	return result, nil
+}
+
+// apply merges every loaded layer into the Inventory. In strict mode, nothing is merged if any
+// problems were found. If any layer can't be merged, the Inventory is left unchanged. ErrFrozen is
+// returned if the Inventory is frozen.
+func (l *loader) apply(i *Inventory, layers []*layer, opts LoadOptions) (*LoadReport, error) {
+	if opts.Strict && len(l.report.Issues) > 0 {
+		return l.report, &ValidationError{Report: l.report}
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if i.frozen {
+		return l.report, ErrFrozen
+	}
+
+	// Merging replaces the Inventory's maps rather than changing them, so keeping the originals is
+	// enough to undo a failed load
+	dictionary, selectRange, ids := i.dictionary, i.selectRange, i.ids
+
+	for _, top := range layers {
+		n, err := top.apply(i)
+		l.report.Loaded += n
+		if err != nil {
+			i.dictionary, i.selectRange, i.ids = dictionary, selectRange, ids
+			l.report.Loaded = 0
+			return l.report, err
+		}
+	}
+
+	return l.report, nil
+}
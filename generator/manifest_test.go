@@ -0,0 +1,203 @@
+/*
+ * Copyright 2020 zpxio (Jeff Sharpe)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package generator
+
+import (
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/suite"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+type ManifestSuite struct {
+	suite.Suite
+}
+
+func TestManifestSuite(t *testing.T) {
+	suite.Run(t, new(ManifestSuite))
+}
+
+func (s *ManifestSuite) TestReadManifest() {
+	m, err := readManifest(map[string]interface{}{
+		"include": []interface{}{"a.yml", "b/*.json"},
+		"mode":    "replace",
+		"remove":  []interface{}{"[Animal:type=cryptid]", " [Plant] "},
+		"scale":   map[string]interface{}{"Animal": 0.5, "Plant": 2},
+	})
+
+	s.Require().NoError(err)
+	s.Equal([]string{"a.yml", "b/*.json"}, m.include)
+	s.Equal(MergeReplace, m.policy.Mode)
+	s.Require().Len(m.policy.Remove, 2)
+	s.Equal("[Animal:type=cryptid]", m.policy.Remove[0].String())
+	s.Equal("[Plant]", m.policy.Remove[1].String())
+	s.Equal(map[string]float64{"Animal": 0.5, "Plant": 2}, m.policy.Scale)
+}
+
+func (s *ManifestSuite) TestReadManifest_Empty() {
+	m, err := readManifest(nil)
+
+	s.NoError(err)
+	s.Empty(m.include)
+	s.Equal(MergePolicy{}, m.policy)
+}
+
+func (s *ManifestSuite) TestReadManifest_Errors() {
+	bad := []map[string]interface{}{
+		{"includes": []interface{}{"a.yml"}},
+		{"include": 4},
+		{"include": []interface{}{""}},
+		{"mode": "overwrite"},
+		{"remove": "[Animal"},
+		{"remove": []interface{}{"[Animal:type=[AnimalType]]"}},
+		{"remove": []interface{}{"Animal"}},
+		{"scale": []interface{}{"Animal"}},
+		{"scale": map[string]interface{}{"Animal": 0}},
+		{"scale": map[string]interface{}{"Animal": "lots"}},
+	}
+
+	for _, settings := range bad {
+		_, err := readManifest(settings)
+		s.Error(err, "%v", settings)
+	}
+}
+
+func (s *ManifestSuite) TestLoad_Manifest() {
+	i := CreateInventory()
+
+	report, err := i.LoadWithReport(filepath.Join(DataDir(), "layers", "product.yml"), LoadOptions{Strict: true})
+
+	s.Require().NoError(err)
+	s.Equal(14, report.Loaded)
+	s.Equal([]string{"Aardvark", "Capybara", "Cladoselache", "Kiwi"}, contents(i, "Animal"))
+	s.Equal(5.0, i.dictionary["Animal"][1].Rarity)
+	s.Equal("swamp", i.dictionary["Animal"][1].Properties["env"])
+	s.InDelta(8.6, i.selectRange["Animal"], 0.001)
+	s.Equal([]string{"Angry", "Confused", "Reluctant", "Happy", "Sleepy"}, contents(i, "Description"))
+	s.InDelta(3.0, i.selectRange["Description"], 0.001)
+	s.InDelta(4.5, i.selectRange["AnimalType"], 0.001)
+}
+
+func (s *ManifestSuite) TestLoad_ManifestAppliesToExistingTokens() {
+	i := BuildSampleInventory()
+	overlay := "remove: ['[Animal:env=water]']\nscale: {AnimalType: 2}\n"
+
+	report, err := i.LoadReaderWithReport(strings.NewReader(overlay), "overlay.yml", LoadOptions{})
+
+	s.NoError(err)
+	s.Equal(0, report.Loaded)
+	s.Equal([]string{"Aardvark", "Boomalope", "Capybara"}, contents(i, "Animal"))
+	s.InDelta(14.4, i.selectRange["AnimalType"], 0.001)
+}
+
+func (s *ManifestSuite) TestLoad_Cycle() {
+	i := CreateInventory()
+
+	err := i.Load(filepath.Join(DataDir(), "layers", "cycle_a.yml"))
+
+	s.Require().Error(err)
+	s.Contains(err.Error(), "include cycle")
+	s.Contains(err.Error(), "cycle_b.toml")
+}
+
+func (s *ManifestSuite) TestLoad_MissingInclude() {
+	i := CreateInventory()
+
+	err := i.LoadReader(strings.NewReader("include: [base.yml]\n"), FormatYAML)
+
+	s.Error(err)
+	s.Contains(err.Error(), "can't be read when loading from a stream")
+}
+
+func (s *ManifestSuite) TestLoadFS_Manifest() {
+	fsys := fstest.MapFS{
+		"base/nouns.yml":      {Data: []byte("- category: Noun\n  content: cat\n- category: Noun\n  content: dog\n")},
+		"base/adjectives.csv": {Data: []byte("category,content,rarity\nAdjective,red,1\nAdjective,blue,2\n")},
+		"product/overlay.json": {Data: []byte(`{
+  "include": ["../base"],
+  "mode": "replace",
+  "scale": {"Adjective": 3},
+  "tokens": [
+    {"category": "Noun", "content": "dog", "rarity": 4},
+    {"category": "Noun", "content": "bird"}
+  ]
+}`)},
+	}
+	i := CreateInventory()
+
+	err := i.LoadFS(fsys, "product/*.json")
+
+	s.Require().NoError(err)
+	s.Equal([]string{"cat", "dog", "bird"}, contents(i, "Noun"))
+	s.InDelta(6.0, i.selectRange["Noun"], 0.001)
+	s.InDelta(9.0, i.selectRange["Adjective"], 0.001)
+}
+
+func (s *ManifestSuite) TestLoadFS_IncludeMatchesNothing() {
+	fsys := fstest.MapFS{
+		"overlay.yml": {Data: []byte("include: [base/*.yml]\n")},
+	}
+	i := CreateInventory()
+
+	err := i.LoadFS(fsys, "overlay.yml")
+
+	s.Error(err)
+	s.Contains(err.Error(), "overlay.yml")
+}
+
+func (s *ManifestSuite) TestLoad_StrictIncludesNothing() {
+	fsys := fstest.MapFS{
+		"base.yml":    {Data: []byte("- category: Noun\n  content: cat\n- category: Noun\n")},
+		"overlay.yml": {Data: []byte("include: [base.yml]\ntokens:\n  - category: Noun\n    content: dog\n")},
+	}
+	i := CreateInventory()
+
+	report, err := i.LoadFSWithReport(fsys, "overlay.yml", LoadOptions{Strict: true})
+
+	s.Error(err)
+	s.Require().Len(report.Issues, 1)
+	s.Equal("base.yml", report.Issues[0].File)
+	s.Equal(0, report.Loaded)
+	s.Empty(i.dictionary)
+}
+
+func (s *ManifestSuite) TestLoad_IDsAcrossLayers() {
+	fsys := fstest.MapFS{
+		"base.yml":    {Data: []byte("- id: pet\n  category: Noun\n  content: cat\n")},
+		"append.yml":  {Data: []byte("include: [base.yml]\ntokens:\n  - id: pet\n    category: Noun\n    content: dog\n")},
+		"replace.yml": {Data: []byte("include: [base.yml]\nmode: replace\ntokens:\n  - id: pet\n    category: Noun\n    content: dog\n")},
+	}
+	i := CreateInventory()
+	i.AddToken("Noun", "bird", 1.0, Properties{})
+
+	err := i.LoadFS(fsys, "append.yml")
+
+	s.Require().Error(err)
+	s.Contains(err.Error(), "append.yml")
+	s.True(errors.Is(err, ErrDuplicateID))
+	s.Equal([]string{"bird"}, contents(i, "Noun"))
+	s.Empty(i.ids)
+
+	err = i.LoadFS(fsys, "replace.yml")
+
+	s.NoError(err)
+	s.Equal([]string{"bird", "dog"}, contents(i, "Noun"))
+	t, _ := i.Get("pet")
+	s.Equal("dog", t.Content)
+}
@@ -0,0 +1,243 @@
+/*
+ * Copyright 2020 zpxio (Jeff Sharpe)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package generator
+
+import (
+	"github.com/pkg/errors"
+)
+
+// MergeMode decides how Tokens merged from another Inventory are combined with existing Tokens.
+type MergeMode int
+
+const (
+	// MergeAppend adds every merged Token, keeping any existing Tokens with the same identity.
+	MergeAppend MergeMode = iota
+	// MergeReplace replaces existing Tokens which share their identity with a merged Token. The
+	// merged Token takes the place of the first match, and any other matches are dropped. Merged
+	// Tokens with no match are appended.
+	MergeReplace
+)
+
+// String returns the name of the MergeMode.
+func (m MergeMode) String() string {
+	switch m {
+	case MergeAppend:
+		return "append"
+	case MergeReplace:
+		return "replace"
+	}
+
+	return "unknown"
+}
+
+// ParseMergeMode finds the MergeMode with the given name.
+func ParseMergeMode(name string) (MergeMode, error) {
+	switch name {
+	case "", "append":
+		return MergeAppend, nil
+	case "replace":
+		return MergeReplace, nil
+	}
+
+	return MergeAppend, errors.Errorf("unknown merge mode: %q", name)
+}
+
+// MergePolicy describes how one Inventory is layered over another. Existing Tokens which match any
+// of the Remove Selectors are removed first, then the rarities of the existing Tokens in each of the
+// Scale categories are multiplied by its factor. Finally, the merged Tokens are added according to
+// the Mode. Removal and scaling only affect the existing Tokens, so merged Tokens always keep the
+// rarities they were defined with.
+type MergePolicy struct {
+	Mode   MergeMode
+	Remove []*Selector
+	Scale  map[string]float64
+}
+
+// identity identifies the Token for the purpose of replacing it. Tokens with the same ID are the
+// same Token. Tokens without an ID are the same Token if they have the same category and content.
+func (t *Token) identity() string {
+	if t.ID != "" {
+		return "id\x00" + t.ID
+	}
+
+	return "content\x00" + t.Category + "\x00" + t.Content
+}
+
+// Merge layers the Tokens of another Inventory over this one, following the policy. The totals used
+// for weighted selection are updated for every category which changes. An error is returned, and
+// nothing is changed, if any scale factor isn't a positive number or if the merge would leave two
+// Tokens with the same ID. Merging into a frozen Inventory returns ErrFrozen.
+func (i *Inventory) Merge(other *Inventory, policy MergePolicy) error {
+	return i.mergeTokens(other.Tokens(), policy)
+}
+
+// mergeTokens layers the Tokens over the Inventory, following the policy.
+func (i *Inventory) mergeTokens(tokens []Token, policy MergePolicy) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if i.frozen {
+		return ErrFrozen
+	}
+
+	return i.mergeLocked(tokens, policy)
+}
+
+// mergeLocked layers the Tokens over the Inventory, following the policy. The Inventory's maps are
+// replaced rather than changed, so that nothing changes if the merge fails. Tokens are never changed
+// in place, since readers may still hold slices returned by getTokens. The caller must hold the write
+// lock.
+func (i *Inventory) mergeLocked(tokens []Token, policy MergePolicy) error {
+	for category, factor := range policy.Scale {
+		if !(factor > 0) {
+			return errors.Errorf("scale factor %v for %s must be a positive number", factor, category)
+		}
+	}
+
+	dictionary := make(map[string][]Token, len(i.dictionary))
+	for category, existing := range i.dictionary {
+		dictionary[category] = existing
+	}
+	changed := make(map[string]bool)
+
+	// Remove matching Tokens
+	for _, s := range policy.Remove {
+		existing := dictionary[s.Category]
+		kept := make([]Token, 0, len(existing))
+		for idx := range existing {
+			if !s.MatchesToken(&existing[idx]) {
+				kept = append(kept, existing[idx])
+			}
+		}
+		if len(kept) != len(existing) {
+			dictionary[s.Category] = kept
+			changed[s.Category] = true
+		}
+	}
+
+	// Scale existing rarities
+	for category, factor := range policy.Scale {
+		scaled := append([]Token(nil), dictionary[category]...)
+		for idx := range scaled {
+			scaled[idx].Rarity *= factor
+		}
+		dictionary[category] = scaled
+		changed[category] = true
+	}
+
+	// Add the merged Tokens
+	for _, t := range tokens {
+		t.compile()
+		changed[t.Category] = true
+
+		if policy.Mode == MergeReplace && replaceToken(dictionary, t, changed) {
+			continue
+		}
+		dictionary[t.Category] = append(dictionary[t.Category], t)
+	}
+
+	ids, err := indexIDs(dictionary)
+	if err != nil {
+		return err
+	}
+
+	selectRange := make(map[string]float64, len(i.selectRange))
+	for category, total := range i.selectRange {
+		selectRange[category] = total
+	}
+	for category := range changed {
+		totalCategory(dictionary, selectRange, category)
+	}
+
+	i.dictionary = dictionary
+	i.selectRange = selectRange
+	i.ids = ids
+
+	return nil
+}
+
+// replaceToken puts the Token in place of the existing Tokens which share its identity. The first
+// match within the Token's category is replaced, and any other matches are dropped, including those
+// in other categories. It returns false if no match was replaced, so the Token still needs to be
+// added. Every category which changes is marked as changed.
+func replaceToken(dictionary map[string][]Token, t Token, changed map[string]bool) bool {
+	id := t.identity()
+	placed := false
+
+	replace := func(category string) {
+		existing := dictionary[category]
+		kept := make([]Token, 0, len(existing))
+		for _, e := range existing {
+			if e.identity() != id {
+				kept = append(kept, e)
+			} else if !placed && category == t.Category {
+				kept = append(kept, t)
+				placed = true
+			}
+		}
+		if len(kept) != len(existing) || placed {
+			dictionary[category] = kept
+			changed[category] = true
+		}
+	}
+
+	replace(t.Category)
+	if t.ID != "" {
+		for category := range dictionary {
+			if category != t.Category {
+				replace(category)
+			}
+		}
+	}
+
+	return placed
+}
+
+// indexIDs maps the ID of every Token to its category, failing if two Tokens share an ID.
+func indexIDs(dictionary map[string][]Token) (map[string]string, error) {
+	ids := make(map[string]string)
+	for category, tokens := range dictionary {
+		for _, t := range tokens {
+			if t.ID == "" {
+				continue
+			}
+			if _, taken := ids[t.ID]; taken {
+				return nil, errors.Wrapf(ErrDuplicateID, "ID %q", t.ID)
+			}
+			ids[t.ID] = category
+		}
+	}
+
+	return ids, nil
+}
+
+// totalCategory recalculates the selection range of a category, dropping the category if it is
+// empty.
+func totalCategory(dictionary map[string][]Token, selectRange map[string]float64, category string) {
+	tokens := dictionary[category]
+	if len(tokens) == 0 {
+		delete(dictionary, category)
+		delete(selectRange, category)
+		return
+	}
+
+	sum := 0.0
+	for _, t := range tokens {
+		sum += t.Rarity
+	}
+	selectRange[category] = sum
+}
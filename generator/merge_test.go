@@ -0,0 +1,240 @@
+/*
+ * Copyright 2020 zpxio (Jeff Sharpe)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package generator
+
+import (
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/suite"
+	"testing"
+)
+
+type MergeSuite struct {
+	suite.Suite
+}
+
+func TestMergeSuite(t *testing.T) {
+	suite.Run(t, new(MergeSuite))
+}
+
+// contents lists the content of each Token in a category, in order.
+func contents(i *Inventory, category string) []string {
+	var result []string
+	for _, t := range i.dictionary[category] {
+		result = append(result, t.Content)
+	}
+
+	return result
+}
+
+func (s *MergeSuite) TestParseMergeMode() {
+	m, err := ParseMergeMode("replace")
+	s.NoError(err)
+	s.Equal(MergeReplace, m)
+	s.Equal("replace", m.String())
+
+	m, err = ParseMergeMode("")
+	s.NoError(err)
+	s.Equal(MergeAppend, m)
+	s.Equal("append", m.String())
+
+	_, err = ParseMergeMode("overwrite")
+	s.Error(err)
+}
+
+func (s *MergeSuite) TestMerge_Append() {
+	i := BuildSampleInventory()
+	other := CreateInventory()
+	other.AddToken("Animal", "Capybara", 3.0, Properties{})
+	other.AddToken("Plant", "Fern", 1.0, Properties{})
+
+	err := i.Merge(other, MergePolicy{})
+
+	s.NoError(err)
+	s.Equal([]string{"Aardvark", "Boomalope", "Capybara", "Cladoselache", "Capybara"}, contents(i, "Animal"))
+	s.InDelta(9.5, i.selectRange["Animal"], 0.001)
+	s.InDelta(1.0, i.selectRange["Plant"], 0.001)
+}
+
+func (s *MergeSuite) TestMerge_Replace() {
+	i := BuildSampleInventory()
+	i.AddToken("Animal", "Capybara", 1.0, Properties{})
+	other := CreateInventory()
+	replacement := other.AddToken("Animal", "Capybara", 0.25, Properties{"type": "rodent"})
+	replacement.OnRenderSet("sound", "squeak")
+	other.AddToken("Animal", "Dodo", 1.0, Properties{})
+
+	err := i.Merge(other, MergePolicy{Mode: MergeReplace})
+
+	s.NoError(err)
+	s.Equal([]string{"Aardvark", "Boomalope", "Capybara", "Cladoselache", "Dodo"}, contents(i, "Animal"))
+	capybara := i.dictionary["Animal"][2]
+	s.Equal(0.25, capybara.Rarity)
+	s.Equal("rodent", capybara.Properties["type"])
+	s.Equal("squeak", capybara.SetVars["sound"])
+	s.InDelta(6.75, i.selectRange["Animal"], 0.001)
+}
+
+func (s *MergeSuite) TestMerge_Remove() {
+	i := BuildSampleInventory()
+
+	err := i.Merge(CreateInventory(), MergePolicy{Remove: []*Selector{
+		ParseSelector("Animal", "type=mammal"),
+		ParseSelector("Missing", ""),
+	}})
+
+	s.NoError(err)
+	s.Equal([]string{"Boomalope", "Cladoselache"}, contents(i, "Animal"))
+	s.InDelta(4.5, i.selectRange["Animal"], 0.001)
+	s.NotContains(i.dictionary, "Missing")
+}
+
+func (s *MergeSuite) TestMerge_RemoveCategory() {
+	i := BuildSampleInventory()
+
+	err := i.Merge(CreateInventory(), MergePolicy{Remove: []*Selector{ParseSelector("Animal", "")}})
+
+	s.NoError(err)
+	s.NotContains(i.dictionary, "Animal")
+	s.NotContains(i.selectRange, "Animal")
+	s.Nil(i.Pick(ParseSelector("Animal", ""), 0.5))
+}
+
+func (s *MergeSuite) TestMerge_Scale() {
+	i := BuildSampleInventory()
+	other := CreateInventory()
+	other.AddToken("Animal", "Dodo", 1.0, Properties{})
+
+	err := i.Merge(other, MergePolicy{Scale: map[string]float64{"Animal": 2.0, "Missing": 3.0}})
+
+	s.NoError(err)
+	s.Equal(2.0, i.dictionary["Animal"][0].Rarity)
+	s.Equal(1.0, i.dictionary["Animal"][4].Rarity)
+	s.InDelta(14.0, i.selectRange["Animal"], 0.001)
+	s.NotContains(i.dictionary, "Missing")
+}
+
+func (s *MergeSuite) TestMerge_BadScale() {
+	i := BuildSampleInventory()
+	other := CreateInventory()
+	other.AddToken("Animal", "Dodo", 1.0, Properties{})
+
+	err := i.Merge(other, MergePolicy{Scale: map[string]float64{"Animal": 0}})
+
+	s.Error(err)
+	s.Len(i.dictionary["Animal"], 4)
+}
+
+func (s *MergeSuite) TestMerge_DoesNotChangeHeldSlices() {
+	i := BuildSampleInventory()
+	held, _ := i.getTokens(ParseSelector("Animal", ""))
+	other := CreateInventory()
+	other.AddToken("Animal", "Aardvark", 9.0, Properties{})
+
+	err := i.Merge(other, MergePolicy{
+		Mode:   MergeReplace,
+		Remove: []*Selector{ParseSelector("Animal", "type=fish")},
+		Scale:  map[string]float64{"Animal": 2.0},
+	})
+
+	s.NoError(err)
+	s.Equal([]string{"Aardvark", "Boomalope", "Capybara", "Cladoselache"}, []string{held[0].Content, held[1].Content, held[2].Content, held[3].Content})
+	s.Equal(1.0, held[0].Rarity)
+	s.Equal(9.0, i.dictionary["Animal"][0].Rarity)
+}
+
+func (s *MergeSuite) TestMerge_Frozen() {
+	i := BuildSampleInventory()
+	i.Freeze()
+
+	other := CreateInventory()
+	other.AddToken("Animal", "Okapi", 1.0, Properties{})
+
+	s.Equal(ErrFrozen, i.Merge(other, MergePolicy{}))
+	s.Len(i.Tokens(), len(BuildSampleInventory().Tokens()))
+}
+
+func (s *MergeSuite) TestMerge_CompilesContent() {
+	i := BuildSampleInventory()
+	other := CreateInventory()
+	other.AddToken("Phrase", "The [Animal]", 1.0, Properties{})
+
+	s.NoError(i.Merge(other, MergePolicy{}))
+
+	s.NotNil(i.dictionary["Phrase"][0].compiled)
+}
+
+func (s *MergeSuite) TestMerge_ReplaceByID() {
+	i := buildIDInventory()
+	other := CreateInventory()
+	moa := BuildToken("Animal", "Moa", 2.0, Properties{})
+	moa.ID = "dodo"
+	other.Add(moa)
+	capybara := BuildToken("Animal", "Capybara", 5.0, Properties{})
+	capybara.ID = "capybara"
+	other.Add(capybara)
+
+	err := i.Merge(other, MergePolicy{Mode: MergeReplace})
+
+	s.NoError(err)
+	s.Equal([]string{"Aardvark", "Boomalope", "Capybara", "Cladoselache", "Moa", "Capybara"}, contents(i, "Animal"))
+	s.InDelta(13.5, i.selectRange["Animal"], 0.001)
+	t, _ := i.Get("dodo")
+	s.Equal("Moa", t.Content)
+}
+
+func (s *MergeSuite) TestMerge_ReplaceByIDAcrossCategories() {
+	i := buildIDInventory()
+	other := CreateInventory()
+	moss := BuildToken("Plant", "Moss", 1.0, Properties{})
+	moss.ID = "dodo"
+	other.Add(moss)
+
+	err := i.Merge(other, MergePolicy{Mode: MergeReplace})
+
+	s.NoError(err)
+	s.Len(i.dictionary["Animal"], 4)
+	s.Equal([]string{"Fern", "Moss"}, contents(i, "Plant"))
+	s.Equal("Plant", i.ids["dodo"])
+}
+
+func (s *MergeSuite) TestMerge_AppendDuplicateID() {
+	i := buildIDInventory()
+	other := CreateInventory()
+	moa := BuildToken("Animal", "Moa", 2.0, Properties{})
+	moa.ID = "dodo"
+	other.Add(moa)
+
+	err := i.Merge(other, MergePolicy{Scale: map[string]float64{"Animal": 2}})
+
+	s.True(errors.Is(err, ErrDuplicateID))
+	s.Len(i.dictionary["Animal"], 5)
+	s.InDelta(8.0, i.selectRange["Animal"], 0.001)
+}
+
+func (s *MergeSuite) TestMerge_RemoveThenAppendID() {
+	i := buildIDInventory()
+	other := CreateInventory()
+	moa := BuildToken("Animal", "Moa", 2.0, Properties{})
+	moa.ID = "dodo"
+	other.Add(moa)
+
+	err := i.Merge(other, MergePolicy{Remove: []*Selector{ParseSelector("Animal", "type=bird")}})
+
+	s.NoError(err)
+	t, _ := i.Get("dodo")
+	s.Equal("Moa", t.Content)
+}
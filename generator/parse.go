@@ -0,0 +1,686 @@
+/*
+ * Copyright 2020 zpxio (Jeff Sharpe)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package generator
+
+import (
+	"strconv"
+	"strings"
+)
+
+// RepeatMax is the largest number of times a {repeat} block may render its body.
+const RepeatMax = 1000
+
+// parser is a hand-written recursive descent parser which compiles instruction text into a list
+// of nodes. The grammar is:
+//
+//	instruction := ( text | tag | block )*
+//	tag         := variable | captured | selector
+//	variable    := '[' '$' name ']'
+//	captured    := '[' '#' name ( '.' name )? ']'
+//	selector    := '[' name ( ':' options )? ( '#' name )? ']'
+//	options     := option? ( ',' option? )*
+//	option      := name ( ( '=' | '!=' ) value )?
+//	value       := ( '#' name ( '.' name )? )? ( name | tag | block | '$' name )*
+//	block       := alternation | conditional | repetition
+//	alternation := '{' choice ( '|' choice )* '}'
+//	choice      := ( text | tag | block )* ( ':' weight )?
+//	conditional := '{if' condition '}' instruction ( '{else}' instruction )? '{end}'
+//	condition   := '!'? '$' name | '$' name ( '=' | '!=' ) text
+//	repetition  := '{repeat' count ( '..' count )? ( 'sep=' quoted | 'last=' quoted | 'unique' )* '}'
+//	               instruction '{end}'
+//
+// Values must not be empty, and a '#' only starts a capture reference at the start of a value, since
+// a '#' after a value starts the selector's capture name. Names consist of letters, digits and
+// underscores, weights are positive numbers, and counts are whole numbers up to RepeatMax. Within
+// text, a backslash escapes a following '[', ']', '{', '}', '|', ':' or another backslash so that it
+// is output literally. Outside of alternations, '|' and ':' are ordinary text. Spaces are allowed
+// around a condition, and are trimmed from the value it compares against. Quoted text is written in
+// double quotes, where a backslash escapes a following '"' or backslash.
+type parser struct {
+	src string
+	pos int
+}
+
+// parse compiles the source text into a list of nodes.
+func parse(src string) ([]node, error) {
+	p := &parser{src: src}
+
+	return p.parseText()
+}
+
+// isNameChar checks if the byte may be part of a category, variable or option name.
+func isNameChar(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+// isEscapable checks if the byte may follow a backslash escape in text.
+func isEscapable(c byte) bool {
+	return strings.IndexByte("[]{}|:\\", c) >= 0
+}
+
+// peek returns the byte at the current position, or zero at the end of input.
+func (p *parser) peek() byte {
+	if p.pos >= len(p.src) {
+		return 0
+	}
+	return p.src[p.pos]
+}
+
+// parseText parses a sequence of text, tags and blocks until the end of input.
+func (p *parser) parseText() ([]node, error) {
+	nodes, err := p.parseSequence(false)
+	if err != nil {
+		return nil, err
+	}
+
+	if p.pos < len(p.src) {
+		return nil, newSyntaxError(p.src, p.pos, "unexpected {%s} without a matching {if}", p.keyword())
+	}
+
+	return nodes, nil
+}
+
+// parseSequence parses text, tags and blocks until the end of input, an {else} or {end} keyword, or
+// the end of the current alternative, which is left unconsumed. Alternatives end at a '|', a '}' or
+// a weight, and are only recognized when inChoice is set.
+func (p *parser) parseSequence(inChoice bool) ([]node, error) {
+	var nodes []node
+	var text strings.Builder
+	textStart := p.pos
+
+	flush := func() {
+		if text.Len() > 0 {
+			nodes = append(nodes, &textNode{pos: textStart, text: text.String()})
+			text.Reset()
+		}
+	}
+
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+
+		switch {
+		case c == '\\' && p.pos+1 < len(p.src) && isEscapable(p.src[p.pos+1]):
+			text.WriteByte(p.src[p.pos+1])
+			p.pos += 2
+		case c == '{' && p.keyword() != "":
+			flush()
+			return nodes, nil
+		case c == '[' || c == '{':
+			flush()
+			n, err := p.parseTagOrBlock()
+			if err != nil {
+				return nil, err
+			}
+			nodes = append(nodes, n)
+			textStart = p.pos
+		case c == ']':
+			return nil, newSyntaxError(p.src, p.pos, "unexpected ']' without a matching '['")
+		case c == '}' && !inChoice:
+			return nil, newSyntaxError(p.src, p.pos, "unexpected '}' without a matching '{'")
+		case inChoice && (c == '|' || c == '}' || (c == ':' && p.weightEnd() > 0)):
+			flush()
+			return nodes, nil
+		default:
+			text.WriteByte(c)
+			p.pos++
+		}
+	}
+	flush()
+
+	return nodes, nil
+}
+
+// parseTagOrBlock parses the tag or block starting at the current position.
+func (p *parser) parseTagOrBlock() (node, error) {
+	if p.isConditional() {
+		return p.parseConditional()
+	}
+	if p.isRepetition() {
+		return p.parseRepetition()
+	}
+	if p.peek() == '{' {
+		return p.parseBlock()
+	}
+
+	return p.parseTag()
+}
+
+// parseName reads a name at the current position, returning an empty string if there is none.
+func (p *parser) parseName() string {
+	start := p.pos
+	for p.pos < len(p.src) && isNameChar(p.src[p.pos]) {
+		p.pos++
+	}
+
+	return p.src[start:p.pos]
+}
+
+// expectTagEnd consumes the closing bracket of the tag starting at start.
+func (p *parser) expectTagEnd(start int) error {
+	switch p.peek() {
+	case ']':
+		p.pos++
+		return nil
+	case 0:
+		return newSyntaxError(p.src, start, "unterminated tag")
+	}
+
+	return newSyntaxError(p.src, p.pos, "unexpected %q in tag", p.peek())
+}
+
+// parseTag parses a variable or selector tag starting at the current '['.
+func (p *parser) parseTag() (node, error) {
+	start := p.pos
+	p.pos++
+
+	// Variable reference
+	if p.peek() == '$' {
+		p.pos++
+		name := p.parseName()
+		if name == "" {
+			return nil, newSyntaxError(p.src, p.pos, "expected a variable name after '[$'")
+		}
+		if err := p.expectTagEnd(start); err != nil {
+			return nil, err
+		}
+
+		return &varNode{pos: start, raw: p.src[start:p.pos], name: name}, nil
+	}
+
+	// Capture reference
+	if p.peek() == '#' {
+		p.pos++
+		n := &captureNode{pos: start, name: p.parseName()}
+		if n.name == "" {
+			return nil, newSyntaxError(p.src, p.pos, "expected a capture name after '[#'")
+		}
+		if p.peek() == '.' {
+			p.pos++
+			if n.property = p.parseName(); n.property == "" {
+				return nil, newSyntaxError(p.src, p.pos, "expected a property name after '.'")
+			}
+		}
+		if err := p.expectTagEnd(start); err != nil {
+			return nil, err
+		}
+		n.raw = p.src[start:p.pos]
+
+		return n, nil
+	}
+
+	// Selector
+	category := p.parseName()
+	if category == "" {
+		if p.peek() == 0 {
+			return nil, newSyntaxError(p.src, start, "unterminated tag")
+		}
+		return nil, newSyntaxError(p.src, p.pos, "expected a category name after '['")
+	}
+
+	n := &selectorNode{pos: start, category: category}
+
+	if p.peek() == ':' {
+		p.pos++
+		options, err := p.parseOptions(start)
+		if err != nil {
+			return nil, err
+		}
+		n.options = options
+	}
+
+	if p.peek() == '#' {
+		p.pos++
+		if n.capture = p.parseName(); n.capture == "" {
+			return nil, newSyntaxError(p.src, p.pos, "expected a capture name after '#'")
+		}
+	}
+
+	if err := p.expectTagEnd(start); err != nil {
+		return nil, err
+	}
+	n.raw = p.src[start:p.pos]
+
+	return n, nil
+}
+
+// parseOptions parses the comma-separated options of the selector tag starting at start, stopping
+// before the closing bracket or capture name. Empty options are permitted and ignored.
+func (p *parser) parseOptions(start int) ([]optionNode, error) {
+	var options []optionNode
+
+	for {
+		switch p.peek() {
+		case ']', '#':
+			return options, nil
+		case ',':
+			p.pos++
+			continue
+		case 0:
+			return nil, newSyntaxError(p.src, start, "unterminated tag")
+		}
+
+		key := p.parseName()
+		if key == "" {
+			return nil, newSyntaxError(p.src, p.pos, "expected a property name in selector options, found %q", p.peek())
+		}
+
+		opt := optionNode{key: key, op: optTypeExists}
+		switch {
+		case p.peek() == '=':
+			opt.op = optTypeRequire
+			p.pos++
+		case strings.HasPrefix(p.src[p.pos:], "!="):
+			opt.op = optTypeExclude
+			p.pos += 2
+		}
+
+		if opt.op != optTypeExists {
+			value, err := p.parseValue()
+			if err != nil {
+				return nil, err
+			}
+			if len(value) == 0 {
+				return nil, newSyntaxError(p.src, p.pos, "expected a value for property %q", key)
+			}
+			opt.value = value
+		}
+		options = append(options, opt)
+
+		if p.peek() != ',' && p.peek() != ']' && p.peek() != '#' {
+			if p.peek() == 0 {
+				return nil, newSyntaxError(p.src, start, "unterminated tag")
+			}
+			return nil, newSyntaxError(p.src, p.pos, "unexpected %q in selector options", p.peek())
+		}
+	}
+}
+
+// parseValue parses an option value made of names, references, nested tags and blocks.
+func (p *parser) parseValue() ([]node, error) {
+	var value []node
+
+	for {
+		switch {
+		case isNameChar(p.peek()):
+			start := p.pos
+			value = append(value, &textNode{pos: start, text: p.parseName()})
+		case p.peek() == '[' || p.peek() == '{':
+			n, err := p.parseTagOrBlock()
+			if err != nil {
+				return nil, err
+			}
+			value = append(value, n)
+		case p.peek() == '$' || (p.peek() == '#' && len(value) == 0):
+			n, err := p.parseReference()
+			if err != nil {
+				return nil, err
+			}
+			value = append(value, n)
+		default:
+			return value, nil
+		}
+	}
+}
+
+// parseBlock parses an alternation block starting at the current '{'.
+func (p *parser) parseBlock() (node, error) {
+	start := p.pos
+	p.pos++
+
+	n := &altNode{pos: start}
+	for {
+		nodes, err := p.parseSequence(true)
+		if err != nil {
+			return nil, err
+		}
+
+		weight := 1.0
+		if p.peek() == ':' {
+			if weight, err = p.parseWeight(); err != nil {
+				return nil, err
+			}
+		}
+		n.choices = append(n.choices, choiceNode{weight: weight, nodes: nodes})
+		n.total += weight
+
+		switch p.peek() {
+		case '|':
+			p.pos++
+		case '}':
+			if len(n.choices) == 1 {
+				return nil, p.singleChoiceError(start)
+			}
+			p.pos++
+			return n, nil
+		case '{':
+			return nil, newSyntaxError(p.src, p.pos, "unexpected {%s} without a matching {if}", p.keyword())
+		default:
+			return nil, newSyntaxError(p.src, start, "unterminated '{'")
+		}
+	}
+}
+
+// singleChoiceError describes a block starting at start which has only one choice. Blocks which
+// look like an {if} or {repeat} missing its condition or count are reported as such.
+func (p *parser) singleChoiceError(start int) error {
+	for _, k := range []struct{ keyword, expected string }{{"if", "a condition"}, {"repeat", "a count"}} {
+		rest := strings.TrimPrefix(p.src[start+1:], k.keyword)
+		if len(rest) < len(p.src)-start-1 && (strings.HasPrefix(rest, " ") || strings.HasPrefix(rest, "}")) {
+			pos := len(p.src) - len(strings.TrimLeft(rest, " "))
+			return newSyntaxError(p.src, pos, "expected %s after {%s", k.expected, k.keyword)
+		}
+	}
+
+	return newSyntaxError(p.src, start, "alternation has only one choice, use \\{ to write a literal '{'")
+}
+
+// weightEnd finds the end of a weight written at the current ':', which must be followed by a
+// number and then the end of the alternative. It returns zero if there is no weight.
+func (p *parser) weightEnd() int {
+	end := p.pos + 1
+	for end < len(p.src) && strings.IndexByte("0123456789.", p.src[end]) >= 0 {
+		end++
+	}
+
+	if end == p.pos+1 || end >= len(p.src) || (p.src[end] != '|' && p.src[end] != '}') {
+		return 0
+	}
+
+	return end
+}
+
+// parseWeight parses the weight of an alternative at the current ':'.
+func (p *parser) parseWeight() (float64, error) {
+	start := p.pos
+	end := p.weightEnd()
+
+	weight, err := strconv.ParseFloat(p.src[start+1:end], 64)
+	if err != nil || !(weight > 0) {
+		return 0, newSyntaxError(p.src, start+1, "weight must be a positive number, found %q", p.src[start+1:end])
+	}
+	p.pos = end
+
+	return weight, nil
+}
+
+// keyword finds the {else} or {end} keyword at the current position, returning an empty string if
+// there is none.
+func (p *parser) keyword() string {
+	for _, k := range []string{"else", "end"} {
+		if strings.HasPrefix(p.src[p.pos:], "{"+k+"}") {
+			return k
+		}
+	}
+
+	return ""
+}
+
+// isConditional checks if an {if} block starts at the current position. Blocks which start with
+// "if" but aren't followed by a condition are alternations.
+func (p *parser) isConditional() bool {
+	rest := strings.TrimPrefix(p.src[p.pos:], "{if")
+	if len(rest) == len(p.src)-p.pos || !strings.HasPrefix(rest, " ") {
+		return false
+	}
+
+	rest = strings.TrimLeft(rest, " ")
+	return strings.HasPrefix(rest, "$") || strings.HasPrefix(rest, "!$")
+}
+
+// skipSpaces moves past any spaces at the current position.
+func (p *parser) skipSpaces() {
+	for p.peek() == ' ' {
+		p.pos++
+	}
+}
+
+// parseConditional parses an {if} block starting at the current position, up to and including its
+// {end} keyword.
+func (p *parser) parseConditional() (node, error) {
+	start := p.pos
+	p.pos += len("{if")
+	p.skipSpaces()
+
+	n := &ifNode{pos: start, cond: condition{op: optTypeExists}}
+	if p.peek() == '!' {
+		n.cond.negate = true
+		p.pos++
+	}
+	p.pos++
+
+	n.cond.name = p.parseName()
+	if n.cond.name == "" {
+		return nil, newSyntaxError(p.src, p.pos, "expected a variable name after '$'")
+	}
+
+	if !n.cond.negate {
+		switch {
+		case p.peek() == '=':
+			n.cond.op = optTypeRequire
+			p.pos++
+		case strings.HasPrefix(p.src[p.pos:], "!="):
+			n.cond.op = optTypeExclude
+			p.pos += 2
+		}
+	}
+	if n.cond.op != optTypeExists {
+		n.cond.value = p.parseConditionValue()
+	}
+
+	p.skipSpaces()
+	switch p.peek() {
+	case '}':
+		p.pos++
+	case 0:
+		return nil, newSyntaxError(p.src, start, "unterminated {if}")
+	default:
+		return nil, newSyntaxError(p.src, p.pos, "unexpected %q in condition", p.peek())
+	}
+
+	var err error
+	if n.then, err = p.parseSequence(false); err != nil {
+		return nil, err
+	}
+	if p.keyword() == "else" {
+		p.pos += len("{else}")
+		if n.otherwise, err = p.parseSequence(false); err != nil {
+			return nil, err
+		}
+	}
+	if p.keyword() != "end" {
+		if p.keyword() == "else" {
+			return nil, newSyntaxError(p.src, p.pos, "unexpected second {else}")
+		}
+		return nil, newSyntaxError(p.src, start, "unterminated {if}, expected {end}")
+	}
+	p.pos += len("{end}")
+
+	return n, nil
+}
+
+// parseConditionValue parses the value a condition compares against, up to its closing '}'.
+func (p *parser) parseConditionValue() string {
+	var value strings.Builder
+	for p.pos < len(p.src) && p.src[p.pos] != '}' {
+		if p.src[p.pos] == '\\' && p.pos+1 < len(p.src) && isEscapable(p.src[p.pos+1]) {
+			p.pos++
+		}
+		value.WriteByte(p.src[p.pos])
+		p.pos++
+	}
+
+	return strings.TrimSpace(value.String())
+}
+
+// isRepetition checks if a {repeat} block starts at the current position. Blocks which start with
+// "repeat" but aren't followed by a count are alternations.
+func (p *parser) isRepetition() bool {
+	rest := strings.TrimPrefix(p.src[p.pos:], "{repeat")
+	if len(rest) == len(p.src)-p.pos || !strings.HasPrefix(rest, " ") {
+		return false
+	}
+
+	rest = strings.TrimLeft(rest, " ")
+	return rest != "" && rest[0] >= '0' && rest[0] <= '9'
+}
+
+// parseRepetition parses a {repeat} block starting at the current position, up to and including its
+// {end} keyword.
+func (p *parser) parseRepetition() (node, error) {
+	start := p.pos
+	p.pos += len("{repeat")
+	p.skipSpaces()
+
+	n := &repeatNode{pos: start}
+	var err error
+	if n.min, err = p.parseCount(); err != nil {
+		return nil, err
+	}
+	n.max = n.min
+	if strings.HasPrefix(p.src[p.pos:], "..") {
+		p.pos += 2
+		countStart := p.pos
+		if n.max, err = p.parseCount(); err != nil {
+			return nil, err
+		}
+		if n.max < n.min {
+			return nil, newSyntaxError(p.src, countStart, "repeat range %d..%d is empty", n.min, n.max)
+		}
+	}
+
+	lastSet := false
+	for {
+		p.skipSpaces()
+		if p.peek() == '}' {
+			p.pos++
+			break
+		}
+		if p.peek() == 0 {
+			return nil, newSyntaxError(p.src, start, "unterminated {repeat}")
+		}
+
+		optStart := p.pos
+		switch name := p.parseName(); name {
+		case "unique":
+			n.unique = true
+		case "sep", "last":
+			if p.peek() != '=' {
+				return nil, newSyntaxError(p.src, p.pos, "expected '=' after %s", name)
+			}
+			p.pos++
+			text, err := p.parseQuoted()
+			if err != nil {
+				return nil, err
+			}
+			if name == "sep" {
+				n.sep = text
+			} else {
+				n.last = text
+				lastSet = true
+			}
+		case "":
+			return nil, newSyntaxError(p.src, p.pos, "unexpected %q in {repeat}", p.peek())
+		default:
+			return nil, newSyntaxError(p.src, optStart, "unknown repeat option %q", name)
+		}
+	}
+	if !lastSet {
+		n.last = n.sep
+	}
+
+	if n.body, err = p.parseSequence(false); err != nil {
+		return nil, err
+	}
+	switch p.keyword() {
+	case "end":
+		p.pos += len("{end}")
+	case "else":
+		return nil, newSyntaxError(p.src, p.pos, "unexpected {else} in {repeat}")
+	default:
+		return nil, newSyntaxError(p.src, start, "unterminated {repeat}, expected {end}")
+	}
+
+	return n, nil
+}
+
+// parseCount parses a repeat count at the current position.
+func (p *parser) parseCount() (int, error) {
+	start := p.pos
+	for p.peek() >= '0' && p.peek() <= '9' {
+		p.pos++
+	}
+
+	count, err := strconv.Atoi(p.src[start:p.pos])
+	if err != nil {
+		return 0, newSyntaxError(p.src, start, "expected a repeat count")
+	}
+	if count > RepeatMax {
+		return 0, newSyntaxError(p.src, start, "repeat count %d is more than the maximum of %d", count, RepeatMax)
+	}
+
+	return count, nil
+}
+
+// parseQuoted parses double-quoted text at the current position.
+func (p *parser) parseQuoted() (string, error) {
+	start := p.pos
+	if p.peek() != '"' {
+		return "", newSyntaxError(p.src, p.pos, "expected quoted text")
+	}
+	p.pos++
+
+	var text strings.Builder
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		switch {
+		case c == '"':
+			p.pos++
+			return text.String(), nil
+		case c == '\\' && p.pos+1 < len(p.src) && (p.src[p.pos+1] == '"' || p.src[p.pos+1] == '\\'):
+			text.WriteByte(p.src[p.pos+1])
+			p.pos += 2
+		default:
+			text.WriteByte(c)
+			p.pos++
+		}
+	}
+
+	return "", newSyntaxError(p.src, start, "unterminated quoted text")
+}
+
+// parseReference parses a variable or capture reference within an option value.
+func (p *parser) parseReference() (node, error) {
+	start := p.pos
+	n := &refNode{pos: start, capture: p.peek() == '#'}
+	p.pos++
+
+	if n.name = p.parseName(); n.name == "" {
+		if n.capture {
+			return nil, newSyntaxError(p.src, p.pos, "expected a capture name after '#'")
+		}
+		return nil, newSyntaxError(p.src, p.pos, "expected a variable name after '$'")
+	}
+	if n.capture && p.peek() == '.' {
+		p.pos++
+		if n.property = p.parseName(); n.property == "" {
+			return nil, newSyntaxError(p.src, p.pos, "expected a property name after '.'")
+		}
+	}
+	n.raw = p.src[start:p.pos]
+
+	return n, nil
+}
@@ -0,0 +1,380 @@
+/*
+ * Copyright 2020 zpxio (Jeff Sharpe)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package generator
+
+import (
+	"errors"
+	"github.com/stretchr/testify/suite"
+	"testing"
+)
+
+type ParseSuite struct {
+	suite.Suite
+}
+
+func TestParseSuite(t *testing.T) {
+	suite.Run(t, new(ParseSuite))
+}
+
+func (s *ParseSuite) TestParse_Text() {
+	nodes, err := parse("Just some text")
+
+	s.NoError(err)
+	s.Require().Len(nodes, 1)
+	s.Equal(&textNode{pos: 0, text: "Just some text"}, nodes[0])
+}
+
+func (s *ParseSuite) TestParse_Empty() {
+	nodes, err := parse("")
+
+	s.NoError(err)
+	s.Empty(nodes)
+}
+
+func (s *ParseSuite) TestParse_Selector() {
+	nodes, err := parse("A [Animal] ran")
+
+	s.NoError(err)
+	s.Require().Len(nodes, 3)
+	s.Equal(&textNode{pos: 0, text: "A "}, nodes[0])
+	s.Equal(&selectorNode{pos: 2, raw: "[Animal]", category: "Animal"}, nodes[1])
+	s.Equal(&textNode{pos: 10, text: " ran"}, nodes[2])
+}
+
+func (s *ParseSuite) TestParse_Variable() {
+	nodes, err := parse("[$name]!")
+
+	s.NoError(err)
+	s.Require().Len(nodes, 2)
+	s.Equal(&varNode{pos: 0, raw: "[$name]", name: "name"}, nodes[0])
+	s.Equal(&textNode{pos: 7, text: "!"}, nodes[1])
+}
+
+func (s *ParseSuite) TestParse_Options() {
+	nodes, err := parse("[Animal:type=mammal,env!=water,,extant]")
+
+	s.NoError(err)
+	s.Require().Len(nodes, 1)
+
+	n := nodes[0].(*selectorNode)
+	s.Equal("Animal", n.category)
+	s.Require().Len(n.options, 3)
+	s.Equal(optionNode{key: "type", op: optTypeRequire, value: []node{&textNode{pos: 13, text: "mammal"}}}, n.options[0])
+	s.Equal(optionNode{key: "env", op: optTypeExclude, value: []node{&textNode{pos: 25, text: "water"}}}, n.options[1])
+	s.Equal(optionNode{key: "extant", op: optTypeExists}, n.options[2])
+}
+
+func (s *ParseSuite) TestParse_NestedOptions() {
+	nodes, err := parse("[Animal:type=[AnimalType:rare=[$r]],env=x[$env]]")
+
+	s.NoError(err)
+	s.Require().Len(nodes, 1)
+
+	n := nodes[0].(*selectorNode)
+	s.Equal("[Animal:type=[AnimalType:rare=[$r]],env=x[$env]]", n.raw)
+	s.Require().Len(n.options, 2)
+
+	s.Require().Len(n.options[0].value, 1)
+	nested := n.options[0].value[0].(*selectorNode)
+	s.Equal("AnimalType", nested.category)
+	s.Equal(13, nested.pos)
+	s.Equal(&varNode{pos: 30, raw: "[$r]", name: "r"}, nested.options[0].value[0])
+
+	s.Require().Len(n.options[1].value, 2)
+	s.Equal(&textNode{pos: 40, text: "x"}, n.options[1].value[0])
+	s.Equal(&varNode{pos: 41, raw: "[$env]", name: "env"}, n.options[1].value[1])
+}
+
+func (s *ParseSuite) TestParse_Escapes() {
+	nodes, err := parse(`a \[b\] \\ \c`)
+
+	s.NoError(err)
+	s.Require().Len(nodes, 1)
+	s.Equal(`a [b] \ \c`, nodes[0].(*textNode).text)
+}
+
+func (s *ParseSuite) TestParse_Alternation() {
+	nodes, err := parse("a {red:3|green|[Colour]:0.5} b")
+
+	s.NoError(err)
+	s.Require().Len(nodes, 3)
+	n, ok := nodes[1].(*altNode)
+	s.Require().True(ok)
+	s.Equal(2, n.pos)
+	s.Equal(4.5, n.total)
+	s.Require().Len(n.choices, 3)
+	s.Equal(choiceNode{weight: 3, nodes: []node{&textNode{pos: 3, text: "red"}}}, n.choices[0])
+	s.Equal(choiceNode{weight: 1, nodes: []node{&textNode{pos: 9, text: "green"}}}, n.choices[1])
+	s.Equal(0.5, n.choices[2].weight)
+	s.Equal(&selectorNode{pos: 15, raw: "[Colour]", category: "Colour"}, n.choices[2].nodes[0])
+}
+
+func (s *ParseSuite) TestParse_AlternationNested() {
+	nodes, err := parse("{[Animal]|{big|small} [Animal:type={mammal|fish}]|}")
+
+	s.NoError(err)
+	s.Require().Len(nodes, 1)
+	n := nodes[0].(*altNode)
+	s.Require().Len(n.choices, 3)
+	s.Empty(n.choices[2].nodes)
+
+	inner := n.choices[1].nodes
+	s.Require().Len(inner, 3)
+	s.IsType(&altNode{}, inner[0])
+	selector := inner[2].(*selectorNode)
+	s.IsType(&altNode{}, selector.options[0].value[0])
+}
+
+func (s *ParseSuite) TestParse_AlternationText() {
+	nodes, err := parse(`a|b: c {note: x|ratio 1\:3|\{x\|y\}:2}`)
+
+	s.NoError(err)
+	s.Require().Len(nodes, 2)
+	s.Equal("a|b: c ", nodes[0].(*textNode).text)
+	n := nodes[1].(*altNode)
+	s.Equal("note: x", n.choices[0].nodes[0].(*textNode).text)
+	s.Equal("ratio 1:3", n.choices[1].nodes[0].(*textNode).text)
+	s.Equal("{x|y}", n.choices[2].nodes[0].(*textNode).text)
+	s.Equal(2.0, n.choices[2].weight)
+}
+
+func (s *ParseSuite) TestParse_Conditional() {
+	nodes, err := parse("Hi {if $gender=female}ma'am{else}sir{end}!")
+
+	s.NoError(err)
+	s.Require().Len(nodes, 3)
+	n, ok := nodes[1].(*ifNode)
+	s.Require().True(ok)
+	s.Equal(3, n.pos)
+	s.Equal(condition{name: "gender", op: optTypeRequire, value: "female"}, n.cond)
+	s.Equal([]node{&textNode{pos: 22, text: "ma'am"}}, n.then)
+	s.Equal([]node{&textNode{pos: 33, text: "sir"}}, n.otherwise)
+}
+
+func (s *ParseSuite) TestParse_Conditions() {
+	cases := map[string]condition{
+		"{if $title}x{end}":                {name: "title", op: optTypeExists},
+		"{if  !$title }x{end}":             {name: "title", op: optTypeExists, negate: true},
+		"{if $kind!=big cat }x{end}":       {name: "kind", op: optTypeExclude, value: "big cat"},
+		`{if $text=a\}b}x{end}`:            {name: "text", op: optTypeRequire, value: "a}b"},
+		"{if $empty=}x{end}":               {name: "empty", op: optTypeRequire},
+		"{if $a}{if !$b}x{end}{else}{end}": {name: "a", op: optTypeExists},
+	}
+
+	for src, cond := range cases {
+		nodes, err := parse(src)
+
+		if s.NoError(err, src) && s.Len(nodes, 1, src) {
+			s.Equal(cond, nodes[0].(*ifNode).cond, src)
+		}
+	}
+}
+
+func (s *ParseSuite) TestParse_ConditionalNested() {
+	nodes, err := parse("{a|{if $x}b|c{end}} [Animal:type={if $t}[$t]{else}cat{end}]")
+
+	s.NoError(err)
+	s.Require().Len(nodes, 3)
+	alt := nodes[0].(*altNode)
+	s.Require().Len(alt.choices, 2)
+	s.Equal("b|c", alt.choices[1].nodes[0].(*ifNode).then[0].(*textNode).text)
+
+	cond := nodes[2].(*selectorNode).options[0].value[0].(*ifNode)
+	s.IsType(&varNode{}, cond.then[0])
+}
+
+func (s *ParseSuite) TestParse_IfAlternation() {
+	nodes, err := parse("{if only|if not}")
+
+	s.NoError(err)
+	s.Require().Len(nodes, 1)
+	s.IsType(&altNode{}, nodes[0])
+}
+
+func (s *ParseSuite) TestParse_Repetition() {
+	nodes, err := parse(`{repeat 2..4 sep=", " last=" and \"so\" " unique}[Description]{end}!`)
+
+	s.NoError(err)
+	s.Require().Len(nodes, 2)
+	n, ok := nodes[0].(*repeatNode)
+	s.Require().True(ok)
+	s.Equal(2, n.min)
+	s.Equal(4, n.max)
+	s.Equal(", ", n.sep)
+	s.Equal(` and "so" `, n.last)
+	s.True(n.unique)
+	s.Require().Len(n.body, 1)
+	s.IsType(&selectorNode{}, n.body[0])
+}
+
+func (s *ParseSuite) TestParse_RepetitionDefaults() {
+	nodes, err := parse(`{repeat 3 sep="-"}x{end}{repeat 0}{end}`)
+
+	s.NoError(err)
+	s.Require().Len(nodes, 2)
+	s.Equal(&repeatNode{pos: 0, min: 3, max: 3, sep: "-", last: "-", body: []node{&textNode{pos: 18, text: "x"}}}, nodes[0])
+	s.Equal(&repeatNode{pos: 24, min: 0, max: 0}, nodes[1])
+}
+
+func (s *ParseSuite) TestParse_RepeatAlternation() {
+	nodes, err := parse("{repeat after me|no}")
+
+	s.NoError(err)
+	s.Require().Len(nodes, 1)
+	s.IsType(&altNode{}, nodes[0])
+}
+
+func (s *ParseSuite) TestParse_Capture() {
+	nodes, err := parse("[Animal#hero] [Animal:type=mammal,env#pet] [#hero] [#pet.family]")
+
+	s.NoError(err)
+	s.Require().Len(nodes, 7)
+	s.Equal(&selectorNode{pos: 0, raw: "[Animal#hero]", category: "Animal", capture: "hero"}, nodes[0])
+
+	pet := nodes[2].(*selectorNode)
+	s.Equal("pet", pet.capture)
+	s.Len(pet.options, 2)
+
+	s.Equal(&captureNode{pos: 43, raw: "[#hero]", name: "hero"}, nodes[4])
+	s.Equal(&captureNode{pos: 51, raw: "[#pet.family]", name: "pet", property: "family"}, nodes[6])
+}
+
+func (s *ParseSuite) TestParse_References() {
+	nodes, err := parse("[Animal:env=$habitat,family=#hero.family,type=x$t[$u]#pet] [Food:diet=#hero#meal]")
+
+	s.NoError(err)
+	s.Require().Len(nodes, 3)
+
+	n := nodes[0].(*selectorNode)
+	s.Equal("pet", n.capture)
+	s.Require().Len(n.options, 3)
+	s.Equal([]node{&refNode{pos: 12, raw: "$habitat", name: "habitat"}}, n.options[0].value)
+	s.Equal([]node{&refNode{pos: 28, raw: "#hero.family", capture: true, name: "hero", property: "family"}}, n.options[1].value)
+	s.Require().Len(n.options[2].value, 3)
+	s.Equal(&refNode{pos: 47, raw: "$t", name: "t"}, n.options[2].value[1])
+
+	food := nodes[2].(*selectorNode)
+	s.Equal("meal", food.capture)
+	s.Equal([]node{&refNode{pos: 70, raw: "#hero", capture: true, name: "hero"}}, food.options[0].value)
+}
+
+func (s *ParseSuite) TestParse_Errors() {
+	cases := map[string]int{
+		"Example: [Animal":            9,
+		"Example: Animal]":            15,
+		"[Animal:type=]":              13,
+		"[Animal:type=mammal":         0,
+		"[Animal type]":               7,
+		"[]":                          1,
+		"[$]":                         2,
+		"[Animal:=x]":                 8,
+		"[Animal:type=mammal env]":    19,
+		"ok\n  [Animal:type!=[Bad":    19,
+		"[Animal:type=[AnimalType]":   0,
+		"a {b|c":                      2,
+		"a b|c}":                      5,
+		"{a:0|b}":                     3,
+		"{a:1.2.3}":                   3,
+		"a {x} b":                     2,
+		`json {"a": 1}`:               5,
+		`json {"a":1}`:                5,
+		"{x:2}":                       0,
+		"{if}":                        3,
+		"{if  x}y{end}":               5,
+		"{a|[b}":                      5,
+		"a {if $x}b":                  2,
+		"a {if $x b{end}":             9,
+		"{if $}x{end}":                5,
+		"{if !$x=y}z{end}":            7,
+		"{if $x}a{else}b{else}c{end}": 15,
+		"a{end}":                      1,
+		"a{else}b":                    1,
+		"{a|{end}}":                   3,
+		"{if $x}a}{end}":              8,
+		"{repeat 3}x":                 0,
+		"{repeat 4..2}x{end}":         11,
+		"{repeat 2000}x{end}":         8,
+		"{repeat 2 sep}x{end}":        13,
+		"{repeat 2 sep=x}x{end}":      14,
+		`{repeat 2 sep="x}x{end}`:     14,
+		"{repeat 2 twice}x{end}":      10,
+		"{repeat 2 !}x{end}":          10,
+		"{repeat 2}x{else}y{end}":     11,
+		"{repeat 2":                   0,
+		"[#]":                         2,
+		"[#hero.]":                    7,
+		"[#hero.family.x]":            13,
+		"[Animal#]":                   8,
+		"[Animal#hero:type=x]":        12,
+		"[Animal:type=x#a#b]":         16,
+		"[Animal:env=$]":              13,
+		"[Animal:env=#]":              13,
+		"[Animal:env=#hero.]":         18,
+		"[Animal:env=$a.b]":           14,
+	}
+
+	for src, pos := range cases {
+		_, err := parse(src)
+
+		var syntax *SyntaxError
+		if s.True(errors.As(err, &syntax), src) {
+			s.Equal(pos, syntax.Position, src)
+		}
+	}
+}
+
+func (s *ParseSuite) TestParse_SingleChoice() {
+	_, err := parse(`json {"a": 1}`)
+
+	var syntax *SyntaxError
+	s.Require().True(errors.As(err, &syntax))
+	s.Contains(syntax.Error(), `\{`)
+
+	nodes, err := parse(`json \{"a": 1\}`)
+
+	s.NoError(err)
+	s.Require().Len(nodes, 1)
+	s.Equal(`json {"a": 1}`, nodes[0].(*textNode).text)
+}
+
+func (s *ParseSuite) TestParse_MissingKeywordArgument() {
+	cases := map[string]string{
+		"{if}x{end}":          "expected a condition after {if",
+		"{if x}y{end}":        "expected a condition after {if",
+		"{repeat}x{end}":      "expected a count after {repeat",
+		"{repeat sep=x}{end}": "expected a count after {repeat",
+	}
+
+	for src, msg := range cases {
+		_, err := parse(src)
+
+		var syntax *SyntaxError
+		if s.True(errors.As(err, &syntax), src) {
+			s.Equal(msg, syntax.Msg, src)
+		}
+	}
+}
+
+func (s *ParseSuite) TestParse_ErrorLocation() {
+	_, err := parse("first line\nsecond [Animal:type=]")
+
+	var syntax *SyntaxError
+	s.Require().True(errors.As(err, &syntax))
+	s.Equal(2, syntax.Line)
+	s.Equal(21, syntax.Column)
+	s.Equal(`syntax error at line 2, column 21: expected a value for property "type"`, syntax.Error())
+}
@@ -0,0 +1,75 @@
+/*
+ * Copyright 2020 zpxio (Jeff Sharpe)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package generator
+
+import (
+	"fmt"
+	"strings"
+)
+
+// MissingAction identifies what a render does when a Selector doesn't match any Token.
+type MissingAction int
+
+const (
+	// MissingFail stops rendering and returns a NoMatchError.
+	MissingFail MissingAction = iota
+	// MissingLeave leaves the selector tag in the output exactly as it was written.
+	MissingLeave
+	// MissingEmpty replaces the selector tag with an empty string.
+	MissingEmpty
+	// MissingFallback replaces the selector tag with a Token picked from a fallback Category.
+	MissingFallback
+)
+
+// MissingPolicy configures how unmatched Selectors are handled during rendering.
+type MissingPolicy struct {
+	Action MissingAction
+	// Fallback is the Category to pick from when Action is MissingFallback.
+	Fallback string
+}
+
+// FailOnMissing is the MissingPolicy which fails rendering on any unmatched Selector.
+var FailOnMissing = MissingPolicy{Action: MissingFail}
+
+// LeaveMissing is the MissingPolicy which leaves unmatched selector tags in the output.
+var LeaveMissing = MissingPolicy{Action: MissingLeave}
+
+// EmptyMissing is the MissingPolicy which removes unmatched selector tags from the output.
+var EmptyMissing = MissingPolicy{Action: MissingEmpty}
+
+// FallbackMissing creates a MissingPolicy which replaces unmatched selector tags with a Token picked
+// from the given Category. If the fallback Category doesn't match either, rendering fails.
+func FallbackMissing(category string) MissingPolicy {
+	return MissingPolicy{Action: MissingFallback, Fallback: category}
+}
+
+// ParseMissingPolicy reads a MissingPolicy from its textual form: "fail", "leave", "empty", or
+// "fallback:Category".
+func ParseMissingPolicy(s string) (MissingPolicy, error) {
+	switch {
+	case s == "fail":
+		return FailOnMissing, nil
+	case s == "leave":
+		return LeaveMissing, nil
+	case s == "empty":
+		return EmptyMissing, nil
+	case strings.HasPrefix(s, "fallback:") && len(s) > len("fallback:"):
+		return FallbackMissing(strings.TrimPrefix(s, "fallback:")), nil
+	}
+
+	return FailOnMissing, fmt.Errorf("unknown missing token policy: %q", s)
+}
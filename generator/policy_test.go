@@ -0,0 +1,57 @@
+/*
+ * Copyright 2020 zpxio (Jeff Sharpe)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package generator
+
+import (
+	"github.com/stretchr/testify/suite"
+	"testing"
+)
+
+type PolicySuite struct {
+	suite.Suite
+}
+
+func TestPolicySuite(t *testing.T) {
+	suite.Run(t, new(PolicySuite))
+}
+
+func (s *PolicySuite) TestParseMissingPolicy() {
+	p, err := ParseMissingPolicy("fail")
+	s.NoError(err)
+	s.Equal(FailOnMissing, p)
+
+	p, err = ParseMissingPolicy("leave")
+	s.NoError(err)
+	s.Equal(LeaveMissing, p)
+
+	p, err = ParseMissingPolicy("empty")
+	s.NoError(err)
+	s.Equal(EmptyMissing, p)
+
+	p, err = ParseMissingPolicy("fallback:Animal")
+	s.NoError(err)
+	s.Equal(MissingFallback, p.Action)
+	s.Equal("Animal", p.Fallback)
+}
+
+func (s *PolicySuite) TestParseMissingPolicy_Invalid() {
+	_, err := ParseMissingPolicy("fallback:")
+	s.Error(err)
+
+	_, err = ParseMissingPolicy("explode")
+	s.Error(err)
+}
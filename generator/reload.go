@@ -0,0 +1,325 @@
+/*
+ * Copyright 2020 zpxio (Jeff Sharpe)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package generator
+
+import (
+	"github.com/pkg/errors"
+	"os"
+	"sync"
+	"time"
+)
+
+// DefaultPollInterval is how often a Watcher checks its files for changes unless configured
+// otherwise.
+const DefaultPollInterval = time.Second
+
+// ReloadEvent describes an attempt by a Watcher to reload its Inventory.
+type ReloadEvent struct {
+	// Inventory is the newly loaded, frozen Inventory, or nil if the reload failed.
+	Inventory *Inventory
+	// Report describes the files loaded and any problems found. It is nil if the files couldn't be
+	// read or parsed.
+	Report *LoadReport
+	// Err describes why the reload failed, or is nil if the new Inventory is in use.
+	Err error
+}
+
+// WatchOptions configures a Watcher.
+type WatchOptions struct {
+	// Load configures how the inventory files are loaded. Loading is always strict, whatever Strict
+	// is set to, so that a change which breaks an entry is rejected rather than dropping it.
+	Load LoadOptions
+	// Interval is how often the files are checked for changes. If it isn't positive,
+	// DefaultPollInterval is used.
+	Interval time.Duration
+	// OnReload, if set, is called after every reload attempt. It is called from the Watcher's own
+	// goroutine, or from the goroutine calling Reload, and must not call Reload or Close.
+	OnReload func(ReloadEvent)
+}
+
+// Watcher keeps an Inventory up to date with the files it was loaded from. It polls the files for
+// changes, checking their modification times and sizes, along with the directories and glob
+// patterns they were found through, so that files which are added or removed are noticed too.
+// Files included by manifests are watched as well.
+//
+// When a change is seen, the files are loaded into a new Inventory. If loading succeeds, and the
+// new Inventory still has every category which an attached Generator's instructions use, it is
+// frozen and swapped into every attached Generator. Otherwise, the current Inventory stays in use,
+// and the failure is reported to the OnReload callback. The files' state is still recorded, so a
+// rejected change is only tried again once a watched file changes again, or Reload is called; the
+// callback isn't repeated for files which haven't changed. Runs which are already in progress finish
+// with the Inventory they started with.
+type Watcher struct {
+	paths []string
+	opts  WatchOptions
+
+	mu         sync.Mutex
+	current    *Inventory
+	generators map[*Generator]bool
+
+	// reloading serializes reloads, and guards the stamps
+	reloading sync.Mutex
+	stamps    map[string]fileStamp
+
+	done    chan struct{}
+	stopped chan struct{}
+	close   sync.Once
+}
+
+// fileStamp records the state of a watched file. Missing files have a zero stamp.
+type fileStamp struct {
+	modified time.Time
+	size     int64
+}
+
+// WatchInventory loads an Inventory from the paths, as described by Inventory.LoadPathsWithReport,
+// and starts watching them for changes. An error is returned if the initial load fails. The Watcher
+// must be closed once it is no longer needed.
+func WatchInventory(paths []string, opts WatchOptions) (*Watcher, error) {
+	if opts.Interval <= 0 {
+		opts.Interval = DefaultPollInterval
+	}
+
+	w := &Watcher{
+		paths:      append([]string(nil), paths...),
+		opts:       opts,
+		generators: make(map[*Generator]bool),
+		done:       make(chan struct{}),
+		stopped:    make(chan struct{}),
+	}
+
+	inv, report, err := w.load()
+	if err != nil {
+		return nil, err
+	}
+	w.current = inv
+	w.stamps = w.stampFiles(report.Files)
+
+	go w.poll()
+
+	return w, nil
+}
+
+// Inventory retrieves the Inventory currently in use. It is frozen, so it never changes; later
+// reloads produce new Inventories instead.
+func (w *Watcher) Inventory() *Inventory {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.current
+}
+
+// Attach makes the Generator use the Watcher's current Inventory, and every Inventory it reloads
+// until the Generator is detached.
+func (w *Watcher) Attach(g *Generator) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.generators[g] = true
+	g.UseInventory(w.current)
+}
+
+// Detach stops the Watcher from swapping reloaded Inventories into the Generator. The Generator
+// keeps using the Inventory it has.
+func (w *Watcher) Detach(g *Generator) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	delete(w.generators, g)
+}
+
+// Reload loads the files again immediately, whether or not they have changed, and returns the
+// reason if the reload fails.
+func (w *Watcher) Reload() error {
+	w.reloading.Lock()
+	defer w.reloading.Unlock()
+
+	event := w.reload()
+	w.notify(event)
+
+	return event.Err
+}
+
+// Close stops watching the files. Attached Generators keep using the current Inventory.
+func (w *Watcher) Close() {
+	w.close.Do(func() {
+		close(w.done)
+	})
+	<-w.stopped
+}
+
+// poll checks the files for changes until the Watcher is closed.
+func (w *Watcher) poll() {
+	defer close(w.stopped)
+
+	ticker := time.NewTicker(w.opts.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.done:
+			return
+		case <-ticker.C:
+			w.check()
+		}
+	}
+}
+
+// check reloads the Inventory if any watched file has changed.
+func (w *Watcher) check() {
+	w.reloading.Lock()
+	defer w.reloading.Unlock()
+
+	if sameStamps(w.stamps, w.stampFiles(watchedFiles(w.stamps))) {
+		return
+	}
+
+	w.notify(w.reload())
+}
+
+// reload loads the files into a new Inventory and swaps it into the attached Generators if it is
+// valid. The caller must hold the reloading lock.
+func (w *Watcher) reload() ReloadEvent {
+	inv, report, err := w.load()
+
+	if err != nil {
+		// Keep watching the files from the last successful load as well as those just read, so that
+		// fixing the problem is noticed
+		files := watchedFiles(w.stamps)
+		if report != nil {
+			files = append(files, report.Files...)
+		}
+		w.stamps = w.stampFiles(files)
+
+		return ReloadEvent{Report: report, Err: err}
+	}
+	w.stamps = w.stampFiles(report.Files)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if err := w.checkCategories(inv); err != nil {
+		return ReloadEvent{Report: report, Err: err}
+	}
+
+	w.current = inv
+	for g := range w.generators {
+		g.UseInventory(inv)
+	}
+
+	return ReloadEvent{Inventory: inv, Report: report}
+}
+
+// checkCategories checks that the new Inventory has every category which the attached Generators'
+// instructions use and the current Inventory has. The caller must hold the lock.
+func (w *Watcher) checkCategories(inv *Inventory) error {
+	for g := range w.generators {
+		if g.template == nil {
+			continue
+		}
+		for _, category := range selectorCategories(g.template.nodes) {
+			if w.current.hasCategory(category) && !inv.hasCategory(category) {
+				return errors.Errorf("Reloaded inventory has no tokens in category %q, which is used by %q", category, g.template.source)
+			}
+		}
+	}
+
+	return nil
+}
+
+// hasCategory checks if the Inventory has any Tokens in the category.
+func (i *Inventory) hasCategory(category string) bool {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	return len(i.dictionary[category]) > 0
+}
+
+// watchedFiles lists the files which have stamps.
+func watchedFiles(stamps map[string]fileStamp) []string {
+	files := make([]string, 0, len(stamps))
+	for name := range stamps {
+		files = append(files, name)
+	}
+
+	return files
+}
+
+// notify reports a reload attempt to the callback.
+func (w *Watcher) notify(event ReloadEvent) {
+	if w.opts.OnReload != nil {
+		w.opts.OnReload(event)
+	}
+}
+
+// load reads the watched paths into a new, frozen Inventory.
+func (w *Watcher) load() (*Inventory, *LoadReport, error) {
+	inv := CreateInventory()
+
+	opts := w.opts.Load
+	opts.Strict = true
+
+	report, err := inv.LoadPathsWithReport(w.paths, opts)
+	if err != nil {
+		return nil, report, errors.Wrap(err, "Failed to load inventory")
+	}
+	inv.Freeze()
+
+	return inv, report, nil
+}
+
+// stampFiles records the state of the files, along with every file currently found through the
+// watched paths.
+func (w *Watcher) stampFiles(files []string) map[string]fileStamp {
+	for _, pattern := range w.paths {
+		found, _ := findInventoryFiles(osSource{}, pattern)
+		files = append(files, found...)
+	}
+
+	stamps := make(map[string]fileStamp, len(files))
+	for _, name := range files {
+		stamps[name] = stampFile(name)
+	}
+
+	return stamps
+}
+
+// stampFile records the state of a single file.
+func stampFile(name string) fileStamp {
+	info, err := os.Stat(name)
+	if err != nil {
+		return fileStamp{}
+	}
+
+	return fileStamp{modified: info.ModTime(), size: info.Size()}
+}
+
+// sameStamps checks if two sets of file stamps are identical.
+func sameStamps(a map[string]fileStamp, b map[string]fileStamp) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for name, stamp := range a {
+		other, found := b[name]
+		if !found || !stamp.modified.Equal(other.modified) || stamp.size != other.size {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,307 @@
+/*
+ * Copyright 2020 zpxio (Jeff Sharpe)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package generator
+
+import (
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/suite"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type ReloadSuite struct {
+	suite.Suite
+	dir    string
+	events chan ReloadEvent
+}
+
+func TestReloadSuite(t *testing.T) {
+	suite.Run(t, new(ReloadSuite))
+}
+
+func (s *ReloadSuite) SetupTest() {
+	s.dir = s.T().TempDir()
+	s.events = make(chan ReloadEvent, 16)
+}
+
+// write replaces the contents of a file in the test directory. The file is replaced in a single
+// step, so that the Watcher never sees it partly written.
+func (s *ReloadSuite) write(name string, content string) {
+	path := filepath.Join(s.dir, name)
+	s.Require().NoError(os.MkdirAll(filepath.Dir(path), 0755))
+
+	temp := filepath.Join(s.T().TempDir(), filepath.Base(name))
+	s.Require().NoError(ioutil.WriteFile(temp, []byte(content), 0644))
+	s.Require().NoError(os.Rename(temp, path))
+}
+
+// watch starts a Watcher on the test directory which reports events to the events channel.
+func (s *ReloadSuite) watch(strict bool, paths ...string) *Watcher {
+	w, err := WatchInventory(paths, WatchOptions{
+		Load:     LoadOptions{Strict: strict},
+		Interval: 5 * time.Millisecond,
+		OnReload: func(e ReloadEvent) { s.events <- e },
+	})
+	s.Require().NoError(err)
+	s.T().Cleanup(w.Close)
+
+	return w
+}
+
+// next waits for the next reload event.
+func (s *ReloadSuite) next() ReloadEvent {
+	select {
+	case e := <-s.events:
+		return e
+	case <-time.After(5 * time.Second):
+		s.FailNow("timed out waiting for a reload")
+	}
+
+	return ReloadEvent{}
+}
+
+func (s *ReloadSuite) TestWatch_Initial() {
+	s.write("animals.yml", "- category: Animal\n  content: Okapi\n")
+	w := s.watch(false, s.dir)
+	g := CreateGenerator("[Animal]", nil)
+
+	w.Attach(g)
+
+	s.True(w.Inventory().IsFrozen())
+	s.Same(w.Inventory(), g.Inventory())
+	s.Equal("Okapi", g.Run())
+}
+
+func (s *ReloadSuite) TestWatch_InitialFailure() {
+	s.write("animals.yml", "- category: Animal\n")
+
+	_, err := WatchInventory([]string{s.dir}, WatchOptions{})
+
+	s.IsType(&ValidationError{}, errors.Cause(err))
+
+	_, err = WatchInventory([]string{filepath.Join(s.dir, "missing.yml")}, WatchOptions{})
+
+	s.Error(err)
+}
+
+func (s *ReloadSuite) TestWatch_Change() {
+	s.write("animals.yml", "- category: Animal\n  content: Okapi\n")
+	w := s.watch(false, filepath.Join(s.dir, "animals.yml"))
+	g := CreateGenerator("[Animal]", nil)
+	w.Attach(g)
+
+	s.write("animals.yml", "- category: Animal\n  content: Tapir\n  rarity: 2\n")
+	e := s.next()
+
+	s.Require().NoError(e.Err)
+	s.Same(e.Inventory, w.Inventory())
+	s.Equal(1, e.Report.Loaded)
+	s.Equal("Tapir", g.Run())
+}
+
+func (s *ReloadSuite) TestWatch_InvalidChangeKeepsInventory() {
+	s.write("animals.yml", "- category: Animal\n  content: Okapi\n")
+	w := s.watch(true, s.dir)
+	g := CreateGenerator("[Animal]", nil)
+	w.Attach(g)
+	original := w.Inventory()
+
+	s.write("animals.yml", "- category: Animal\n  content: Tapir\n- category: Animal\n")
+	e := s.next()
+
+	s.Error(e.Err)
+	s.IsType(&ValidationError{}, errors.Cause(e.Err))
+	s.Nil(e.Inventory)
+	s.Require().NotNil(e.Report)
+	s.Len(e.Report.Issues, 1)
+	s.Same(original, w.Inventory())
+	s.Equal("Okapi", g.Run())
+
+	s.write("animals.yml", "- category: Animal\n  content: Tapir\n")
+	e = s.next()
+
+	s.NoError(e.Err)
+	s.Equal("Tapir", g.Run())
+}
+
+func (s *ReloadSuite) TestWatch_NonStrictRejectsBrokenEntry() {
+	s.write("animals.yml", "- category: Animal\n  content: Okapi\n- category: Animal\n  content: Tapir\n")
+	w := s.watch(false, s.dir)
+	original := w.Inventory()
+
+	s.write("animals.yml", "- category: Animal\n  content: Okapi\n- category: Animal\n")
+	e := s.next()
+
+	s.IsType(&ValidationError{}, errors.Cause(e.Err))
+	s.Nil(e.Inventory)
+	s.Same(original, w.Inventory())
+	s.Len(w.Inventory().Tokens(), 2)
+}
+
+func (s *ReloadSuite) TestWatch_LostCategoryKeepsInventory() {
+	s.write("animals.yml", "- category: Animal\n  content: Okapi\n")
+	s.write("plants.yml", "- category: Plant\n  content: Oak\n")
+	w := s.watch(false, s.dir)
+	g := CreateGenerator("[Animal] under an [Plant]", nil)
+	w.Attach(g)
+	original := w.Inventory()
+
+	s.write("plants.yml", "- category: Tree\n  content: Oak\n")
+	e := s.next()
+
+	s.Error(e.Err)
+	s.Contains(e.Err.Error(), `"Plant"`)
+	s.Same(original, w.Inventory())
+	s.Equal("Okapi under an Oak", g.Run())
+
+	w.Detach(g)
+	s.NoError(w.Reload())
+	s.Nil(s.next().Err)
+}
+
+func (s *ReloadSuite) TestWatch_LostCategoryRetriedWhenFixed() {
+	s.write("animals.yml", "- category: Animal\n  content: Okapi\n")
+	w := s.watch(false, s.dir)
+	g := CreateGenerator("[Animal]", nil)
+	w.Attach(g)
+	original := w.Inventory()
+
+	s.write("animals.yml", "- category: Beast\n  content: Okapi\n")
+	e := s.next()
+
+	s.Error(e.Err)
+	s.Same(original, w.Inventory())
+
+	// The rejected files aren't reloaded again until they change
+	time.Sleep(50 * time.Millisecond)
+	s.Empty(s.events)
+
+	s.write("animals.yml", "- category: Animal\n  content: Tapir\n")
+	e = s.next()
+
+	s.NoError(e.Err)
+	s.Same(e.Inventory, w.Inventory())
+	s.Equal("Tapir", g.Run())
+}
+
+func (s *ReloadSuite) TestWatch_NewFile() {
+	s.write("animals.yml", "- category: Animal\n  content: Okapi\n")
+	w := s.watch(false, s.dir)
+
+	s.write("plants/trees.yml", "- category: Plant\n  content: Oak\n")
+	e := s.next()
+
+	s.Require().NoError(e.Err)
+	s.Len(w.Inventory().Tokens(), 2)
+}
+
+func (s *ReloadSuite) TestWatch_IncludedFile() {
+	s.write("shared/base.yml", "- category: Animal\n  content: Okapi\n")
+	s.write("product/overlay.yml", "include: [../shared/base.yml]\n")
+	w := s.watch(false, filepath.Join(s.dir, "product"))
+
+	s.write("shared/base.yml", "- category: Animal\n  content: Tapir\n")
+	e := s.next()
+
+	s.Require().NoError(e.Err)
+	s.Equal("Tapir", w.Inventory().Tokens()[0].Content)
+}
+
+func (s *ReloadSuite) TestReload() {
+	s.write("animals.yml", "- category: Animal\n  content: Okapi\n")
+	w, err := WatchInventory([]string{s.dir}, WatchOptions{Interval: time.Hour})
+	s.Require().NoError(err)
+	defer w.Close()
+	original := w.Inventory()
+
+	s.NoError(w.Reload())
+
+	s.False(original == w.Inventory())
+
+	s.write("animals.yml", "[")
+	s.Error(w.Reload())
+	s.Equal("Okapi", w.Inventory().Tokens()[0].Content)
+}
+
+func (s *ReloadSuite) TestDetach() {
+	s.write("animals.yml", "- category: Animal\n  content: Okapi\n")
+	w := s.watch(false, s.dir)
+	g := CreateGenerator("[Animal]", nil)
+	w.Attach(g)
+
+	w.Detach(g)
+	s.NoError(w.Reload())
+	<-s.events
+
+	s.False(w.Inventory() == g.Inventory())
+	s.Equal("Okapi", g.Run())
+}
+
+// blockingSource blocks the first value it supplies until it is released.
+type blockingSource struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func (b *blockingSource) Next() float64 {
+	if b.started != nil {
+		close(b.started)
+		b.started = nil
+		<-b.release
+	}
+
+	return 0.5
+}
+
+func (s *ReloadSuite) TestWatch_InFlightRenderKeepsSnapshot() {
+	s.write("animals.yml", "- category: Animal\n  content: Okapi\n")
+	w := s.watch(false, s.dir)
+	g := CreateGenerator("[Animal] [Animal]", nil)
+	w.Attach(g)
+	source := &blockingSource{started: make(chan struct{}), release: make(chan struct{})}
+	g.UseRandomSource(source)
+
+	result := make(chan string)
+	started := source.started
+	go func() {
+		result <- g.Run()
+	}()
+	<-started
+
+	s.write("animals.yml", "- category: Animal\n  content: Tapir\n  rarity: 2\n")
+	s.NoError(s.next().Err)
+	close(source.release)
+
+	s.Equal("Okapi Okapi", <-result)
+	s.Equal("Tapir Tapir", g.Run())
+}
+
+func (s *ReloadSuite) TestClose() {
+	s.write("animals.yml", "- category: Animal\n  content: Okapi\n")
+	w := s.watch(false, s.dir)
+
+	w.Close()
+	w.Close()
+	s.write("animals.yml", "- category: Animal\n  content: Tapir\n  rarity: 2\n")
+	time.Sleep(20 * time.Millisecond)
+
+	s.Empty(s.events)
+	s.Equal("Okapi", w.Inventory().Tokens()[0].Content)
+}
@@ -17,97 +17,362 @@
 package generator
 
 import (
+	"fmt"
 	"github.com/apex/log"
+	"github.com/pkg/errors"
 	"github.com/zpxio/octogen/rng"
-	"regexp"
 	"strings"
 )
 
-// RoundsMax defines the maximum number of replacement rounds allowed during Rendering.
+// RoundsMax defines the maximum depth to which Token content containing further tags is rendered.
+// Deeper nesting indicates categories which reference each other cyclically.
 const RoundsMax = uint8(30)
 
-var selectorRegex *regexp.Regexp
-var varRegex *regexp.Regexp
+// renderer evaluates parsed instructions against an Inventory and State.
+type renderer struct {
+	inventory *Inventory
+	state     *State
+	source    rng.RandomSource
+	missing   MissingPolicy
 
-func init() {
-	selectorRegex = regexp.MustCompile(`\[(\w+)(:((,?(\w+(!?=\w+)?)?)+))?]`)
-	varRegex = regexp.MustCompile(`\[\$(\w+)]`)
+	// picked lists the IDs of the Tokens picked so far, in the order they were picked
+	picked []string
+	// used holds the identities of the Tokens picked within the outermost unique {repeat} block being
+	// rendered, which mustn't be picked again. It is nil outside of unique blocks.
+	used map[string]bool
 }
 
-// replaceNextToken replaces the first complete token found
-func replaceNextToken(working string, i *Inventory, s *State, source rng.RandomSource) (string, bool) {
-	// Find the next token
-	matches := selectorRegex.FindStringSubmatch(working)
+// render evaluates each node in order, writing the results to out. The depth is the number of
+// Tokens whose content is currently being rendered.
+func (r *renderer) render(nodes []node, out *strings.Builder, depth int) error {
+	for _, n := range nodes {
+		switch x := n.(type) {
+		case *textNode:
+			out.WriteString(x.text)
+		case *varNode:
+			r.renderVar(x, out)
+		case *captureNode:
+			r.renderCapture(x, out)
+		case *refNode:
+			val, err := x.resolve(r.state.Vars, r.state.Captures)
+			if err != nil {
+				return err
+			}
+			out.WriteString(val)
+		case *selectorNode:
+			if err := r.renderSelector(x, out, depth); err != nil {
+				return err
+			}
+		case *altNode:
+			if err := r.render(x.choose(r.source.Next()).nodes, out, depth); err != nil {
+				return err
+			}
+		case *ifNode:
+			if err := r.render(x.branch(r.state.Vars), out, depth); err != nil {
+				return err
+			}
+		case *repeatNode:
+			if err := r.renderRepeat(x, out, depth); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// renderVar writes the value of a State variable. Variables which are unset or empty are left in the
+// output as they were written.
+func (r *renderer) renderVar(n *varNode, out *strings.Builder) {
+	val := r.state.Vars[n.name]
+	log.Debugf("Found Var reference: %s=%s", n.name, val)
 
-	if matches == nil {
-		return working, false
+	if val == "" {
+		out.WriteString(n.raw)
+		return
 	}
 
-	log.Infof("Found tokens: %#v", matches)
-	fullMatch := matches[0]
-	selectorId := matches[1]
-	selectorOptions := matches[3]
+	out.WriteString(val)
+}
 
-	selector := ParseSelector(selectorId, selectorOptions)
+// choose picks an alternative, weighted in the same way as Inventory.Pick.
+func (n *altNode) choose(offset float64) *choiceNode {
+	target := offset * n.total
+	cumulative := 0.0
+
+	for idx := range n.choices {
+		cumulative += n.choices[idx].weight
+		if target < cumulative {
+			return &n.choices[idx]
+		}
+	}
+
+	return &n.choices[len(n.choices)-1]
+}
 
-	tv := i.Pick(selector, source.Next())
-	working = strings.Replace(working, fullMatch, tv.Content, 1)
-	s.SetVars(tv.SetVars)
+// holds evaluates the condition against the variables.
+func (c *condition) holds(vars map[string]string) bool {
+	val := vars[c.name]
 
-	log.Infof("Working value is now: %s", working)
+	var result bool
+	switch c.op {
+	case optTypeRequire:
+		result = val == c.value
+	case optTypeExclude:
+		result = val != c.value
+	default:
+		result = val != ""
+	}
 
-	return working, true
+	return result != c.negate
 }
 
-// replaceNextVar replaces the next variable found
-func replaceNextVar(working string, s *State) (string, bool) {
-	matches := varRegex.FindAllStringSubmatch(working, 20)
+// branch selects the nodes to render for the variables.
+func (n *ifNode) branch(vars map[string]string) []node {
+	if n.cond.holds(vars) {
+		return n.then
+	}
+
+	return n.otherwise
+}
 
-	if matches == nil {
-		log.Infof("Found no variable matches")
-		return working, false
+// renderCapture writes the content, or a property, of a captured Token. References to captures
+// which haven't been made, or to properties the Token doesn't have, are left in the output as they
+// were written.
+func (r *renderer) renderCapture(n *captureNode, out *strings.Builder) {
+	val, found := lookupCapture(r.state.Captures, n.name, n.property)
+	if !found {
+		out.WriteString(n.raw)
+		return
 	}
 
-	for _, m := range matches {
-		tag := m[0]
-		varName := m[1]
+	out.WriteString(val)
+}
 
-		val := s.Vars[varName]
-		log.Infof("Found Var reference: %s=%s", varName, val)
-		if val != "" {
-			working = strings.Replace(working, tag, val, 1)
-			return working, true
+// resolve finds the value of a reference, failing if the variable is unset or empty, the capture
+// hasn't been made, or the captured Token doesn't have the property.
+func (n *refNode) resolve(vars map[string]string, captures map[string]Capture) (string, error) {
+	fail := func(format string, args ...interface{}) (string, error) {
+		return "", &ReferenceError{Reference: n.raw, Position: n.pos, Reason: fmt.Sprintf(format, args...)}
+	}
+
+	if !n.capture {
+		val := vars[n.name]
+		if val == "" {
+			return fail("variable %q is not set", n.name)
 		}
+		return val, nil
+	}
+
+	c, found := captures[n.name]
+	if !found {
+		return fail("capture %q has not been made", n.name)
+	}
+	if n.property == "" {
+		return c.Text, nil
+	}
+
+	val, found := c.Token.Properties[n.property]
+	if !found {
+		return fail("captured token %q has no property %q", c.Token.Content, n.property)
 	}
 
-	return working, false
+	return val, nil
 }
 
-// Render generates output from the supplied instruction string using the Inventory, State and RandomSource.
-// The instructions are rendered by replacing one element at a time, selecting the first complete Token or
-// first complete Variable found (in that order). Tokens or Variables which include other Token or Variable
-// references are considered invalid/incomplete and will be skipped.
-func Render(instruction string, i *Inventory, state *State, source rng.RandomSource) string {
-	var replaced bool
-	rounds := RoundsMax
-	working := instruction
-
-	// Keep trying until there aren't changes or all the rounds are expended
-	for rounds > 0 {
-		// Try to replace tokens
-		working, replaced = replaceNextToken(working, i, state, source)
-
-		// Try to replace variables if no tokens were replaced
-		if !replaced {
-			working, replaced = replaceNextVar(working, state)
+// buildSelector renders the option values of a selector node to produce a Selector.
+func (r *renderer) buildSelector(n *selectorNode, depth int) (*Selector, error) {
+	s := newSelector(n.category)
+
+	for _, opt := range n.options {
+		var value strings.Builder
+		if err := r.render(opt.value, &value, depth); err != nil {
+			return nil, err
 		}
+		s.addOption(opt.key, opt.op, value.String())
+	}
 
-		if !replaced {
-			rounds = 0
-		} else {
-			rounds -= 1
+	return s, nil
+}
+
+// renderSelector picks a Token for a selector node and writes its rendered content.
+func (r *renderer) renderSelector(n *selectorNode, out *strings.Builder, depth int) error {
+	selector, err := r.buildSelector(n, depth)
+	if err != nil {
+		return err
+	}
+
+	t := r.pick(selector)
+	if t == nil {
+		missing := &NoMatchError{Selector: selector, Category: selector.Category, Tag: n.raw, Position: n.pos}
+
+		switch r.missing.Action {
+		case MissingLeave:
+			out.WriteString(n.raw)
+			return nil
+		case MissingEmpty:
+			return nil
+		case MissingFallback:
+			t = r.inventory.Pick(newSelector(r.missing.Fallback), r.source.Next())
+			if t == nil {
+				return missing
+			}
+		default:
+			return missing
 		}
 	}
 
-	return working
+	log.Debugf("Picked %s for %s", t.Content, n.raw)
+	if t.ID != "" {
+		r.picked = append(r.picked, t.ID)
+	}
+	if r.used != nil {
+		r.used[t.identity()] = true
+	}
+	r.state.SetVars(t.SetVars)
+
+	if n.capture == "" {
+		return r.renderContent(t, out, depth+1)
+	}
+
+	var content strings.Builder
+	if err := r.renderContent(t, &content, depth+1); err != nil {
+		return err
+	}
+	r.state.capture(n.capture, t, content.String())
+	out.WriteString(content.String())
+
+	return nil
+}
+
+// pick picks a Token for the Selector, skipping any which were already used within a unique
+// {repeat} block. It returns nil if no Token is available.
+func (r *renderer) pick(selector *Selector) *Token {
+	if r.used == nil {
+		return r.inventory.Pick(selector, r.source.Next())
+	}
+
+	tokens, total := unusedTokens(r.inventory, selector, r.used)
+	return pickToken(tokens, total, r.source.Next())
+}
+
+// unusedTokens finds the Tokens matching the Selector whose identities aren't in the used set, along
+// with their total Rarity.
+func unusedTokens(i *Inventory, selector *Selector, used map[string]bool) ([]Token, float64) {
+	tokens, _ := i.getTokens(selector)
+
+	var unused []Token
+	total := 0.0
+	for idx := range tokens {
+		if !used[tokens[idx].identity()] {
+			unused = append(unused, tokens[idx])
+			total += tokens[idx].Rarity
+		}
+	}
+
+	return unused, total
+}
+
+// renderRepeat writes the body of a {repeat} block as many times as it picks, with separators
+// between them.
+func (r *renderer) renderRepeat(n *repeatNode, out *strings.Builder, depth int) error {
+	count := n.min
+	if n.max > n.min {
+		count = n.count(r.source.Next())
+	}
+
+	if n.unique && r.used == nil {
+		r.used = make(map[string]bool)
+		defer func() {
+			r.used = nil
+		}()
+	}
+
+	for idx := 0; idx < count; idx++ {
+		out.WriteString(n.separator(idx, count))
+		if err := r.render(n.body, out, depth); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// count picks the number of repetitions at the given offset (0 <= offset < 1) through the range.
+func (n *repeatNode) count(offset float64) int {
+	count := n.min + int(offset*float64(n.max-n.min+1))
+	if count > n.max {
+		count = n.max
+	}
+
+	return count
+}
+
+// separator finds the text written before the repetition at idx.
+func (n *repeatNode) separator(idx int, count int) string {
+	switch {
+	case idx == 0:
+		return ""
+	case idx == count-1:
+		return n.last
+	}
+
+	return n.sep
+}
+
+// renderContent writes the content of a picked Token, rendering any tags it contains. Content is
+// normally compiled when the Token is added to the Inventory, but Tokens built elsewhere are compiled
+// as they are rendered.
+func (r *renderer) renderContent(t *Token, out *strings.Builder, depth int) error {
+	content := t.compiled
+	if content == nil {
+		if !hasTags(t.Content) {
+			out.WriteString(t.Content)
+			return nil
+		}
+
+		var err error
+		content, err = Compile(t.Content)
+		if err != nil {
+			return errors.Wrapf(err, "parsing content of token %q in category %q", t.Content, t.Category)
+		}
+	}
+
+	if depth > int(RoundsMax) {
+		return &DepthError{Category: t.Category, Depth: depth}
+	}
+
+	return r.render(content.nodes, out, depth)
+}
+
+// hasTags checks if text contains characters which need to be parsed before it can be rendered.
+func hasTags(text string) bool {
+	return strings.ContainsAny(text, "[]{}\\")
+}
+
+// Render generates output from the supplied instruction string using the Inventory, State and RandomSource.
+// The instructions are parsed and then rendered from left to right. Selector options are rendered before
+// their selector, and the content of each picked Token is rendered before moving on, so variables set by
+// a Token are available to everything after it. Selectors which don't match any Token, and instructions
+// which can't be parsed, are left in the output unchanged; use TryRender to detect them.
+func Render(instruction string, i *Inventory, state *State, source rng.RandomSource) string {
+	result, err := TryRender(instruction, i, state, source, LeaveMissing)
+	if err != nil {
+		log.WithError(err).Warn("Failed to render instructions")
+		return instruction
+	}
+
+	return result
+}
+
+// TryRender generates output in the same way as Render, but handles Selectors which don't match any Token
+// according to the supplied MissingPolicy. If the instruction can't be parsed, a *SyntaxError is returned.
+// If the policy requires it, a *NoMatchError is returned. In either case, the result is empty.
+func TryRender(instruction string, i *Inventory, state *State, source rng.RandomSource, policy MissingPolicy) (string, error) {
+	t, err := Compile(instruction)
+	if err != nil {
+		return "", err
+	}
+
+	return t.Render(i, state, source, policy)
 }
@@ -17,8 +17,10 @@
 package generator
 
 import (
+	"errors"
 	"github.com/stretchr/testify/suite"
 	"github.com/zpxio/octogen/rng"
+	"strings"
 	"testing"
 )
 
@@ -30,152 +32,461 @@ func TestRenderSuite(t *testing.T) {
 	suite.Run(t, new(RenderSuite))
 }
 
-func (s *RenderSuite) TestReplaceNextToken() {
-	t := "Example: [Animal]"
+func (s *RenderSuite) TestRender() {
+	t := "Example: [Animal:type=[AnimalType]]"
+	i := BuildSampleInventory()
+
+	result := Render(t, i, CreateState(), rng.UseStatic(0))
+
+	s.Equal("Example: Aardvark", result)
+}
+
+func (s *RenderSuite) TestRender_WithVar() {
+	t := "Example: [Animal:type=[$type]]"
 	i := BuildSampleInventory()
 	x := CreateState()
+	x.Vars["type"] = "mammal"
 
-	working, replaced := replaceNextToken(t, i, x, rng.UseStatic(0))
-	s.True(replaced)
+	result := Render(t, i, x, rng.UseStatic(0))
 
-	s.Equal("Example: Aardvark", working)
+	s.Equal("Example: Aardvark", result)
 }
 
-func (s *RenderSuite) TestReplaceNextToken_Multiple() {
-	t := "Example: [Description] [Animal]"
+func (s *RenderSuite) TestRender_MultipleRender() {
+	t := "Example: [Animal:type=[$type]]"
 	i := BuildSampleInventory()
 	x := CreateState()
+	x.Vars["type"] = "mammal"
 
-	working, replaced := replaceNextToken(t, i, x, rng.UseStatic(0))
+	result := Render(t, i, x, rng.UseStatic(0))
+	s.Equal("Example: Aardvark", result)
 
-	s.True(replaced)
-	s.Equal("Example: Angry [Animal]", working)
+	result2 := Render(t, i, x, rng.UseStatic(1))
+	s.Equal("Example: Capybara", result2)
+}
 
-	working, replaced = replaceNextToken(working, i, x, rng.UseStatic(0))
+func (s *RenderSuite) TestRender_WithVarSet() {
+	t := "Example: [Animal:family=ape] Sentience: [$sentience]"
+	i := BuildSampleInventory()
 
-	s.True(replaced)
-	s.Equal("Example: Angry Aardvark", working)
+	t1 := i.AddToken("Animal", "Human", 1.0, Properties{"type": "mammal", "env": "land", "family": "ape"})
+	t1.OnRenderSet("human", "normal")
+	t1.OnRenderSet("sentience", "full")
+
+	t2 := i.AddToken("Animal", "Chimpanzee", 1.0, Properties{"type": "mammal", "env": "land", "family": "ape"})
+	t2.OnRenderSet("sentience", "high")
+
+	t3 := i.AddToken("AnimalFamily", "ape", 1.0, Properties{"special": "true"})
+	t3.OnRenderSet("sentience", "moderate")
+
+	result1 := Render(t, i, CreateState(), rng.UseStatic(0))
+	s.Equal("Example: Human Sentience: full", result1)
+
+	result2 := Render(t, i, CreateState(), rng.UseStatic(1.2))
+	s.Equal("Example: Chimpanzee Sentience: high", result2)
+}
+
+func (s *RenderSuite) TestRender_NoMatchLeavesTag() {
+	t := "Example: [Unicorn] [Animal:type=[Unicorn]] [Animal]"
+	i := BuildSampleInventory()
+
+	result := Render(t, i, CreateState(), rng.UseStatic(0))
+
+	s.Equal("Example: [Unicorn] [Animal:type=[Unicorn]] Aardvark", result)
 }
 
-func (s *RenderSuite) TestReplaceNextToken_Tagged() {
+func (s *RenderSuite) TestTryRender_Fail() {
+	t := "Example: [Description] [Unicorn]"
+	i := BuildSampleInventory()
+
+	result, err := TryRender(t, i, CreateState(), rng.UseStatic(0), FailOnMissing)
+
+	s.Empty(result)
+	var missing *NoMatchError
+	s.Require().True(errors.As(err, &missing))
+	s.Equal("Unicorn", missing.Category)
+	s.Equal("[Unicorn]", missing.Tag)
+	s.Equal(23, missing.Position)
+}
+
+func (s *RenderSuite) TestTryRender_Empty() {
+	t := "Example: [Unicorn][Animal]"
+	i := BuildSampleInventory()
+
+	result, err := TryRender(t, i, CreateState(), rng.UseStatic(0), EmptyMissing)
+
+	s.NoError(err)
+	s.Equal("Example: Aardvark", result)
+}
+
+func (s *RenderSuite) TestTryRender_Fallback() {
+	t := "Example: [Animal:type=bird]"
+	i := BuildSampleInventory()
+
+	result, err := TryRender(t, i, CreateState(), rng.UseStatic(0), FallbackMissing("Description"))
+
+	s.NoError(err)
+	s.Equal("Example: Angry", result)
+}
+
+func (s *RenderSuite) TestTryRender_FallbackMissing() {
+	t := "Example: [Animal:type=bird]"
+	i := BuildSampleInventory()
+
+	_, err := TryRender(t, i, CreateState(), rng.UseStatic(0), FallbackMissing("Plant"))
+
+	var missing *NoMatchError
+	s.Require().True(errors.As(err, &missing))
+	s.Equal("Animal", missing.Category)
+}
+
+func (s *RenderSuite) TestRender_Multiple() {
+	t := "Example: [Description] [Animal]"
+	i := BuildSampleInventory()
+
+	result := Render(t, i, CreateState(), rng.UseStatic(0))
+
+	s.Equal("Example: Angry Aardvark", result)
+}
+
+func (s *RenderSuite) TestRender_Tagged() {
 	t := "Example: [Animal:family=rodent]"
 	i := BuildSampleInventory()
-	x := CreateState()
 
-	working, replaced := replaceNextToken(t, i, x, rng.UseStatic(0))
+	result := Render(t, i, CreateState(), rng.UseStatic(0))
 
-	s.True(replaced)
-	s.Equal("Example: Capybara", working)
+	s.Equal("Example: Capybara", result)
 }
 
-func (s *RenderSuite) TestReplaceNextToken_Nested() {
+func (s *RenderSuite) TestRender_NestedOrder() {
 	t := "Example: [Animal:type=[AnimalType]]"
 	i := BuildSampleInventory()
-	x := CreateState()
 
-	working, replaced := replaceNextToken(t, i, x, rng.UseStatic(1))
+	// The nested AnimalType is picked first, then the Animal
+	r := rng.UseManual(0.9, 0)
+
+	result := Render(t, i, CreateState(), r)
 
-	s.True(replaced)
-	s.Equal("Example: [Animal:type=cryptid]", working)
+	s.Equal("Example: Boomalope", result)
 }
 
-func (s *RenderSuite) TestReplaceNextToken_NoToken() {
-	t := "Example: Done"
+func (s *RenderSuite) TestRender_UndefinedVar() {
+	t := "Example: [$name] [Animal:type=[$selectType]]"
 	i := BuildSampleInventory()
+
+	result, err := TryRender(t, i, CreateState(), rng.UseStatic(0), LeaveMissing)
+
+	s.NoError(err)
+	s.Equal("Example: [$name] [Animal:type=[$selectType]]", result)
+}
+
+func (s *RenderSuite) TestRender_NoLimitOnTags() {
+	t := strings.Repeat("[Animal]", 50)
+	i := BuildSampleInventory()
+
+	result := Render(t, i, CreateState(), rng.UseStatic(0))
+
+	s.Equal(strings.Repeat("Aardvark", 50), result)
+}
+
+func (s *RenderSuite) TestRender_Escaped() {
+	t := `Example: \[Animal\] [Animal] \\ \n`
+	i := BuildSampleInventory()
+
+	result := Render(t, i, CreateState(), rng.UseStatic(0))
+
+	s.Equal(`Example: [Animal] Aardvark \ \n`, result)
+}
+
+func (s *RenderSuite) TestRender_NestedContent() {
+	i := BuildSampleInventory()
+	i.AddToken("Creature", "[Description] [Animal:type=[AnimalType]]", 1.0, Properties{})
+
+	result, err := TryRender("A [Creature].", i, CreateState(), rng.UseStatic(0), FailOnMissing)
+
+	s.NoError(err)
+	s.Equal("A Angry Aardvark.", result)
+}
+
+func (s *RenderSuite) TestRender_ContentSetsVars() {
+	i := BuildSampleInventory()
+	t1 := i.AddToken("Hero", "[Animal:family=rodent]", 1.0, Properties{})
+	t1.OnRenderSet("name", "Cappy")
+
+	result, err := TryRender("[Hero] named [$name]", i, CreateState(), rng.UseStatic(0), FailOnMissing)
+
+	s.NoError(err)
+	s.Equal("Capybara named Cappy", result)
+}
+
+func (s *RenderSuite) TestTryRender_Cycle() {
+	i := BuildSampleInventory()
+	i.AddToken("Loop", "again [Loop]", 1.0, Properties{})
+
+	_, err := TryRender("[Loop]", i, CreateState(), rng.UseStatic(0), FailOnMissing)
+
+	var depth *DepthError
+	s.Require().True(errors.As(err, &depth))
+	s.Equal("Loop", depth.Category)
+}
+
+func (s *RenderSuite) TestTryRender_SyntaxError() {
+	i := BuildSampleInventory()
+
+	_, err := TryRender("Example: [Animal", i, CreateState(), rng.UseStatic(0), FailOnMissing)
+
+	var syntax *SyntaxError
+	s.Require().True(errors.As(err, &syntax))
+	s.Equal(9, syntax.Position)
+
+	s.Equal("Example: [Animal", Render("Example: [Animal", i, CreateState(), rng.UseStatic(0)))
+}
+
+func (s *RenderSuite) TestTryRender_BadContent() {
+	i := BuildSampleInventory()
+	i.AddToken("Broken", "oops [Animal", 1.0, Properties{})
+
+	_, err := TryRender("[Broken]", i, CreateState(), rng.UseStatic(0), FailOnMissing)
+
+	var syntax *SyntaxError
+	s.True(errors.As(err, &syntax))
+}
+
+func (s *RenderSuite) TestRender_Alternation() {
+	i := BuildSampleInventory()
+	t := "{a|an|the:2} [Animal:type={mammal|fish}]"
+
+	result, err := TryRender(t, i, CreateState(), rng.UseManual(0.2, 0.9, 0.0), FailOnMissing)
+
+	s.NoError(err)
+	s.Equal("a Cladoselache", result)
+
+	result, err = TryRender(t, i, CreateState(), rng.UseManual(0.3, 0.1, 0.6), FailOnMissing)
+
+	s.NoError(err)
+	s.Equal("an Capybara", result)
+
+	result, err = TryRender(t, i, CreateState(), rng.UseManual(0.5, 0.1, 0.0), FailOnMissing)
+
+	s.NoError(err)
+	s.Equal("the Aardvark", result)
+}
+
+func (s *RenderSuite) TestRender_AlternationNested() {
+	i := BuildSampleInventory()
+
+	result, err := TryRender("{[Animal]|[Description] [Animal]}", i, CreateState(), rng.UseManual(0.9, 0.0, 0.0), FailOnMissing)
+
+	s.NoError(err)
+	s.Equal("Angry Aardvark", result)
+}
+
+func (s *RenderSuite) TestRender_AlternationInContent() {
+	i := BuildSampleInventory()
+	i.AddToken("Greeting", "{Hello|Hi} there", 1.0, Properties{})
+
+	result, err := TryRender("[Greeting]", i, CreateState(), rng.UseManual(0.0, 0.7), FailOnMissing)
+
+	s.NoError(err)
+	s.Equal("Hi there", result)
+}
+
+func (s *RenderSuite) TestRender_Conditional() {
+	i := BuildSampleInventory()
+	t := "{if $gender=female}She{else}He{end} met {if $title}[$title] {end}{if !$name}someone{end}"
+
 	x := CreateState()
+	x.Vars["gender"] = "female"
+	result, err := TryRender(t, i, x, rng.UseStatic(0), FailOnMissing)
+
+	s.NoError(err)
+	s.Equal("She met someone", result)
 
-	working, replaced := replaceNextToken(t, i, x, rng.UseStatic(1))
+	x = CreateState()
+	x.Vars["title"] = "Lord"
+	x.Vars["name"] = "Bob"
+	result, err = TryRender(t, i, x, rng.UseStatic(0), FailOnMissing)
 
-	s.False(replaced)
-	s.Equal("Example: Done", working)
+	s.NoError(err)
+	s.Equal("He met Lord ", result)
 }
 
-func (s *RenderSuite) TestReplaceNextVar() {
-	t := "Example: [Animal:type=[$type]]"
+func (s *RenderSuite) TestRender_ConditionalSetVars() {
+	i := CreateInventory()
+	t := i.AddToken("Hero", "Alice", 1.0, Properties{})
+	t.OnRenderSet("gender", "female")
+	t = i.AddToken("Hero", "Bob", 1.0, Properties{})
+	t.OnRenderSet("gender", "male")
 
-	state := CreateState()
-	state.Vars["type"] = "mammal"
+	template := "[Hero] lost {if $gender!=female}his{else}her{end} map"
 
-	working, replaced := replaceNextVar(t, state)
+	result, err := TryRender(template, i, CreateState(), rng.UseStatic(0), FailOnMissing)
+	s.NoError(err)
+	s.Equal("Alice lost her map", result)
 
-	s.True(replaced)
-	s.Equal("Example: [Animal:type=mammal]", working)
+	result, err = TryRender(template, i, CreateState(), rng.UseStatic(0.9), FailOnMissing)
+	s.NoError(err)
+	s.Equal("Bob lost his map", result)
 }
 
-func (s *RenderSuite) TestReplaceNextVar_NoVar() {
-	t := "Example: [Animal:type=amphibian]"
+func (s *RenderSuite) TestRender_ConditionalSkipsPicks() {
+	i := BuildSampleInventory()
+
+	// Branches which aren't taken draw no random values
+	result, err := TryRender("{if $x}[Animal]{else}[Description]{end}", i, CreateState(), rng.UseManual(0.0), FailOnMissing)
+
+	s.NoError(err)
+	s.Equal("Angry", result)
+}
+
+func (s *RenderSuite) TestRender_Repeat() {
+	i := BuildSampleInventory()
+	t := `{repeat 2..4 sep=", " last=" and "}[Description]{end}`
+
+	result, err := TryRender(t, i, CreateState(), rng.UseManual(0.0, 0.0, 0.9), FailOnMissing)
 
-	state := CreateState()
-	state.Vars["type"] = "mammal"
+	s.NoError(err)
+	s.Equal("Angry and Happy", result)
 
-	working, replaced := replaceNextVar(t, state)
+	result, err = TryRender(t, i, CreateState(), rng.UseManual(0.9, 0.0, 0.3, 0.5, 0.9), FailOnMissing)
 
-	s.False(replaced)
-	s.Equal("Example: [Animal:type=amphibian]", working)
+	s.NoError(err)
+	s.Equal("Angry, Confused, Reluctant and Happy", result)
 }
 
-func (s *RenderSuite) TestReplaceNextVar_UndefinedVar() {
-	t := "Example: [Animal:type=[$selectType]]"
+func (s *RenderSuite) TestRender_RepeatFixed() {
+	i := BuildSampleInventory()
+
+	// Fixed counts draw no random value
+	result, err := TryRender(`{repeat 3 sep="-"}[Animal]{end}`, i, CreateState(), rng.UseManual(0.0, 0.0, 0.0), FailOnMissing)
+
+	s.NoError(err)
+	s.Equal("Aardvark-Aardvark-Aardvark", result)
+}
 
-	state := CreateState()
-	state.Vars["type"] = "mammal"
+func (s *RenderSuite) TestRender_RepeatUnique() {
+	i := BuildSampleInventory()
 
-	working, replaced := replaceNextVar(t, state)
+	result, err := TryRender(`{repeat 3 sep=" " unique}[Animal]{end} [Animal]`, i, CreateState(), rng.UseManual(0.0, 0.0, 0.0, 0.0), FailOnMissing)
 
-	s.False(replaced)
-	s.Equal("Example: [Animal:type=[$selectType]]", working)
+	s.NoError(err)
+	s.Equal("Aardvark Boomalope Capybara Aardvark", result)
 }
 
-func (s *RenderSuite) TestRender() {
-	t := "Example: [Animal:type=[AnimalType]]"
+func (s *RenderSuite) TestRender_RepeatUniqueExhausted() {
 	i := BuildSampleInventory()
 
-	result := Render(t, i, CreateState(), rng.UseStatic(0))
+	_, err := TryRender(`{repeat 3 unique}[Animal:type=mammal]{end}`, i, CreateState(), rng.UseStatic(0), FailOnMissing)
 
-	s.Equal("Example: Aardvark", result)
+	var noMatch *NoMatchError
+	s.True(errors.As(err, &noMatch))
+
+	result, err := TryRender(`{repeat 3 unique}[Animal:type=mammal]{end}`, i, CreateState(), rng.UseStatic(0), EmptyMissing)
+
+	s.NoError(err)
+	s.Equal("AardvarkCapybara", result)
 }
 
-func (s *RenderSuite) TestRender_WithVar() {
-	t := "Example: [Animal:type=[$type]]"
+func (s *RenderSuite) TestRender_RepeatUniqueRangeExhausted() {
+	i := BuildSampleInventory()
+	t := `{repeat 1..2 unique}[Description:tone=positive]{end}`
+
+	result, err := TryRender(t, i, CreateState(), rng.UseManual(0.0, 0.0), FailOnMissing)
+
+	s.NoError(err)
+	s.Equal("Happy", result)
+
+	// Picking the upper bound runs out of Tokens, even though the lower bound could be met
+	_, err = TryRender(t, i, CreateState(), rng.UseManual(0.9, 0.0, 0.0), FailOnMissing)
+
+	var noMatch *NoMatchError
+	s.Require().True(errors.As(err, &noMatch))
+	s.Equal("Description", noMatch.Category)
+}
+
+func (s *RenderSuite) TestRender_Capture() {
 	i := BuildSampleInventory()
+	t := "The [Animal#hero] met [Animal]. The [#hero] ([#hero.family]) ran away from [#villain]."
+
+	result, err := TryRender(t, i, CreateState(), rng.UseManual(0.5, 0.0), FailOnMissing)
+
+	s.NoError(err)
+	s.Equal("The Capybara met Aardvark. The Capybara (rodent) ran away from [#villain].", result)
+}
+
+func (s *RenderSuite) TestRender_CaptureState() {
+	i := BuildSampleInventory()
+	i.AddToken("Creature", "[Description] [Animal:type=fish]", 1.0, Properties{"size": "big"})
 	x := CreateState()
-	x.Vars["type"] = "mammal"
 
-	result := Render(t, i, x, rng.UseStatic(0))
+	result, err := TryRender("[Creature#c]! [#c.size] [#c.missing] [#c]", i, x, rng.UseStatic(0), FailOnMissing)
 
-	s.Equal("Example: Aardvark", result)
+	s.NoError(err)
+	s.Equal("Angry Cladoselache! big [#c.missing] Angry Cladoselache", result)
+	s.Require().Contains(x.Captures, "c")
+	s.Equal("Angry Cladoselache", x.Captures["c"].Text)
+	s.Equal("Creature", x.Captures["c"].Token.Category)
 }
 
-func (s *RenderSuite) TestRender_MultipleRender() {
-	t := "Example: [Animal:type=[$type]]"
+func (s *RenderSuite) TestRender_CaptureInContent() {
+	i := BuildSampleInventory()
+	i.AddToken("Scene", "[Animal:type=mammal#hero] chased [Animal:type=fish]", 1.0, Properties{})
+
+	// States built without CreateState still record captures
+	result, err := TryRender("[Scene], then the [#hero] slept", i, &State{Vars: map[string]string{}}, rng.UseStatic(0.9), FailOnMissing)
+
+	s.NoError(err)
+	s.Equal("Capybara chased Cladoselache, then the Capybara slept", result)
+}
+
+func (s *RenderSuite) TestRender_VariableFilter() {
 	i := BuildSampleInventory()
 	x := CreateState()
-	x.Vars["type"] = "mammal"
+	x.Vars["habitat"] = "water"
 
-	result := Render(t, i, x, rng.UseStatic(0))
-	s.Equal("Example: Aardvark", result)
+	result, err := TryRender("[Animal:env=$habitat]", i, x, rng.UseStatic(0), FailOnMissing)
 
-	result2 := Render(t, i, x, rng.UseStatic(1))
-	s.Equal("Example: Capybara", result2)
+	s.NoError(err)
+	s.Equal("Cladoselache", result)
 }
 
-func (s *RenderSuite) TestRender_WithVarSet() {
-	t := "Example: [Animal:family=ape] Sentience: [$sentience]"
+func (s *RenderSuite) TestRender_VariableFilterSetVars() {
 	i := BuildSampleInventory()
+	t := i.AddToken("Place", "the sea", 1.0, Properties{})
+	t.OnRenderSet("habitat", "water")
 
-	t1 := i.AddToken("Animal", "Human", 1.0, Properties{"type": "mammal", "env": "land", "family": "ape"})
-	t1.OnRenderSet("human", "normal")
-	t1.OnRenderSet("sentience", "full")
+	result, err := TryRender("In [Place] lived [Animal:env=$habitat]", i, CreateState(), rng.UseStatic(0), FailOnMissing)
 
-	t2 := i.AddToken("Animal", "Chimpanzee", 1.0, Properties{"type": "mammal", "env": "land", "family": "ape"})
-	t2.OnRenderSet("sentience", "high")
+	s.NoError(err)
+	s.Equal("In the sea lived Cladoselache", result)
+}
 
-	t3 := i.AddToken("AnimalFamily", "ape", 1.0, Properties{"special": "true"})
-	t3.OnRenderSet("sentience", "moderate")
+func (s *RenderSuite) TestRender_CaptureFilter() {
+	i := BuildSampleInventory()
+	i.AddToken("Food", "grubs", 1.0, Properties{"diet": "orycteropod"})
+	i.AddToken("Food", "grass", 1.0, Properties{"diet": "rodent"})
+	i.AddToken("Food", "fish", 1.0, Properties{"diet": "shark"})
 
-	result1 := Render(t, i, CreateState(), rng.UseStatic(0))
-	s.Equal("Example: Human Sentience: full", result1)
+	result, err := TryRender("The [Animal:type=mammal#hero] ate [Food:diet=#hero.family]", i, CreateState(), rng.UseManual(0.9, 0.0), FailOnMissing)
 
-	result2 := Render(t, i, CreateState(), rng.UseStatic(1.2))
-	s.Equal("Example: Chimpanzee Sentience: high", result2)
+	s.NoError(err)
+	s.Equal("The Capybara ate grass", result)
+}
+
+func (s *RenderSuite) TestRender_UnresolvedReference() {
+	i := BuildSampleInventory()
+	cases := map[string]string{
+		"[Animal:env=$habitat]":                  `variable "habitat" is not set`,
+		"[Animal:family=#hero.family]":           `capture "hero" has not been made`,
+		"[Animal#hero] [Animal:size=#hero.size]": `captured token "Aardvark" has no property "size"`,
+	}
+
+	for src, reason := range cases {
+		_, err := TryRender(src, i, CreateState(), rng.UseStatic(0), FailOnMissing)
+
+		var ref *ReferenceError
+		if s.True(errors.As(err, &ref), src) {
+			s.Equal(reason, ref.Reason, src)
+		}
+	}
 }
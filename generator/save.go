@@ -0,0 +1,109 @@
+/*
+ * Copyright 2020 zpxio (Jeff Sharpe)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package generator
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/BurntSushi/toml"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+	"io"
+	"io/ioutil"
+	"sort"
+)
+
+// Tokens returns a copy of every Token in the Inventory in canonical order: categories are sorted
+// by name, and the Tokens within each category keep the order in which they were added. Since the
+// order of Tokens within a category decides which Token each random value picks, preserving it
+// means that a saved and reloaded Inventory generates exactly the same output.
+func (i *Inventory) Tokens() []Token {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	categories := make([]string, 0, len(i.dictionary))
+	for c := range i.dictionary {
+		categories = append(categories, c)
+	}
+	sort.Strings(categories)
+
+	tokens := make([]Token, 0)
+	for _, c := range categories {
+		for _, t := range i.dictionary[c] {
+			t.Properties = copyMap(t.Properties)
+			t.SetVars = copyMap(t.SetVars)
+			tokens = append(tokens, t)
+		}
+	}
+
+	return tokens
+}
+
+// Save writes every Token in the Inventory to a file which can be read back with Load. The format
+// is detected from the file's extension, as described by FormatForPath.
+func (i *Inventory) Save(path string) error {
+	var buf bytes.Buffer
+	if err := i.Write(&buf, FormatForPath(path)); err != nil {
+		return err
+	}
+
+	if err := ioutil.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		return errors.Wrap(err, "Failed to write inventory file.")
+	}
+
+	return nil
+}
+
+// Write writes every Token in the Inventory in the given Format, which may be YAML, JSON or TOML.
+// FormatAuto is treated as YAML. Tokens are written in the order given by Tokens, and properties
+// and variables are sorted by name, so the same Inventory always produces the same output.
+func (i *Inventory) Write(w io.Writer, format Format) error {
+	tokens := i.Tokens()
+
+	switch format {
+	case FormatAuto, FormatYAML:
+		enc := yaml.NewEncoder(w)
+		enc.SetIndent(2)
+		if err := enc.Encode(tokens); err != nil {
+			return errors.Wrap(err, "Failed to write YAML inventory.")
+		}
+		return enc.Close()
+	case FormatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetEscapeHTML(false)
+		enc.SetIndent("", "  ")
+		return errors.Wrap(enc.Encode(tokens), "Failed to write JSON inventory.")
+	case FormatTOML:
+		doc := struct {
+			Tokens []Token `toml:"tokens"`
+		}{Tokens: tokens}
+		return errors.Wrap(toml.NewEncoder(w).Encode(doc), "Failed to write TOML inventory.")
+	}
+
+	return fmt.Errorf("inventories can't be written as %s", format)
+}
+
+// copyMap returns a copy of a map of strings. A nil map is copied as an empty map.
+func copyMap(m map[string]string) map[string]string {
+	c := make(map[string]string, len(m))
+	for k, v := range m {
+		c[k] = v
+	}
+
+	return c
+}
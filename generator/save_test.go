@@ -0,0 +1,203 @@
+/*
+ * Copyright 2020 zpxio (Jeff Sharpe)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package generator
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/suite"
+	"github.com/zpxio/octogen/rng"
+	"path/filepath"
+	"testing"
+)
+
+type SaveSuite struct {
+	suite.Suite
+}
+
+func TestSaveSuite(t *testing.T) {
+	suite.Run(t, new(SaveSuite))
+}
+
+// buildAwkwardInventory builds an Inventory whose values need quoting or escaping in every format.
+func buildAwkwardInventory() *Inventory {
+	i := CreateInventory()
+
+	i.AddToken("Word", "yes", 0.1, Properties{"kind": "no", "count": "1.0"})
+	i.AddToken("Word", "  padded: \"quoted\" # not a comment", 1e-7, Properties{"": "empty key", "html": "<a href='x'>&</a>"})
+	i.AddToken("Word", "multi\nline\ttext", 2.5, Properties{})
+	t := BuildToken("Animal", "[Description] Zebra \\[striped\\]", 1.0, Properties{"type": "mammal"})
+	t.ID = "zebra: 1"
+	t.OnRenderSet("sound", "neigh")
+	t.OnRenderSet("lang", "日本語")
+	i.Add(t)
+	i.AddToken("Description", "null", 3, nil)
+
+	return i
+}
+
+// stripCompiled removes the compiled form of each Token so that Tokens can be compared by value.
+func stripCompiled(tokens []Token) []Token {
+	for idx := range tokens {
+		tokens[idx].compiled = nil
+	}
+
+	return tokens
+}
+
+func (s *SaveSuite) TestTokens_Order() {
+	i := buildAwkwardInventory()
+
+	tokens := i.Tokens()
+
+	s.Require().Len(tokens, 5)
+	s.Equal("Animal", tokens[0].Category)
+	s.Equal("Description", tokens[1].Category)
+	s.Equal("yes", tokens[2].Content)
+	s.Equal("  padded: \"quoted\" # not a comment", tokens[3].Content)
+	s.Equal("multi\nline\ttext", tokens[4].Content)
+}
+
+func (s *SaveSuite) TestTokens_Copy() {
+	i := buildAwkwardInventory()
+
+	tokens := i.Tokens()
+	tokens[0].Properties["type"] = "changed"
+	tokens[0].SetVars["sound"] = "changed"
+
+	s.Equal("mammal", i.dictionary["Animal"][0].Properties["type"])
+	s.Equal("neigh", i.dictionary["Animal"][0].SetVars["sound"])
+}
+
+func (s *SaveSuite) TestWrite_YAML() {
+	i := CreateInventory()
+	t := i.AddToken("Animal", "Zebra", 0.5, Properties{"type": "mammal", "env": "ground"})
+	t.OnRenderSet("sound", "neigh")
+	i.AddToken("AnimalType", "mammal", 1, Properties{})
+
+	var buf bytes.Buffer
+	err := i.Write(&buf, FormatYAML)
+
+	s.NoError(err)
+	s.Equal(`- category: Animal
+  content: Zebra
+  rarity: 0.5
+  properties:
+    env: ground
+    type: mammal
+  setvars:
+    sound: neigh
+- category: AnimalType
+  content: mammal
+  rarity: 1
+`, buf.String())
+}
+
+func (s *SaveSuite) TestWrite_JSON() {
+	i := CreateInventory()
+	i.AddToken("Animal", "Zebra & <Okapi>", 0.5, Properties{"type": "mammal"})
+
+	var buf bytes.Buffer
+	err := i.Write(&buf, FormatJSON)
+
+	s.NoError(err)
+	s.Equal(`[
+  {
+    "category": "Animal",
+    "content": "Zebra & <Okapi>",
+    "rarity": 0.5,
+    "properties": {
+      "type": "mammal"
+    }
+  }
+]
+`, buf.String())
+}
+
+func (s *SaveSuite) TestWrite_Empty() {
+	for _, f := range []Format{FormatYAML, FormatJSON, FormatTOML} {
+		var buf bytes.Buffer
+		s.NoError(CreateInventory().Write(&buf, f))
+
+		i := CreateInventory()
+		s.NoError(i.LoadReader(&buf, f), f.String())
+		s.Empty(i.Tokens())
+	}
+}
+
+func (s *SaveSuite) TestWrite_Unsupported() {
+	var buf bytes.Buffer
+
+	err := buildAwkwardInventory().Write(&buf, FormatCSV)
+
+	s.Error(err)
+	s.Contains(err.Error(), "csv")
+}
+
+func (s *SaveSuite) TestWrite_Stable() {
+	for _, f := range []Format{FormatYAML, FormatJSON, FormatTOML} {
+		var a, b bytes.Buffer
+		s.NoError(buildAwkwardInventory().Write(&a, f))
+		s.NoError(buildAwkwardInventory().Write(&b, f))
+
+		s.Equal(a.String(), b.String(), f.String())
+	}
+}
+
+func (s *SaveSuite) TestRoundTrip() {
+	original := buildAwkwardInventory()
+
+	for _, f := range []Format{FormatYAML, FormatJSON, FormatTOML} {
+		var buf bytes.Buffer
+		s.Require().NoError(original.Write(&buf, f))
+
+		loaded := CreateInventory()
+		report, err := loaded.LoadReaderWithReport(&buf, "", LoadOptions{Format: f, Strict: true})
+
+		s.Require().NoError(err, f.String())
+		s.Empty(report.Issues)
+		s.Equal(stripCompiled(original.Tokens()), stripCompiled(loaded.Tokens()), f.String())
+	}
+}
+
+func (s *SaveSuite) TestSave_RoundTripOutput() {
+	original := CreateInventory()
+	s.Require().NoError(original.Load(filepath.Join(DataDir(), "inv_animals.yml")))
+
+	for _, name := range []string{"saved.yml", "saved.json", "saved.toml"} {
+		path := filepath.Join(s.T().TempDir(), name)
+		s.Require().NoError(original.Save(path))
+
+		loaded := CreateInventory()
+		s.Require().NoError(loaded.Load(path))
+
+		instruction := "[Description] [Animal] [Animal:type=mammal]"
+		for seed := uint64(1); seed <= 20; seed++ {
+			a := CreateGenerator(instruction, original)
+			a.UseRandomSource(rng.UseSeeded(seed))
+			b := CreateGenerator(instruction, loaded)
+			b.UseRandomSource(rng.UseSeeded(seed))
+
+			s.Equal(a.Run(), b.Run(), name)
+		}
+	}
+}
+
+func (s *SaveSuite) TestSave_BadPath() {
+	err := buildAwkwardInventory().Save(filepath.Join(s.T().TempDir(), "missing", "saved.yml"))
+
+	s.Error(err)
+}
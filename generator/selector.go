@@ -19,6 +19,9 @@ package generator
 import (
 	"github.com/apex/log"
 	"regexp"
+	"sort"
+	"strconv"
+	"strings"
 )
 
 var optRegex *regexp.Regexp
@@ -48,12 +51,7 @@ type Selector struct {
 
 // ParseSelector examines string parts to create a new Selector.
 func ParseSelector(category string, options string) *Selector {
-	s := Selector{
-		Category: category,
-		Require:  make(map[string]string),
-		Exclude:  make(map[string]string),
-		Exists:   make(map[string]bool),
-	}
+	s := newSelector(category)
 
 	// Parse the options
 	//optParts := strings.Split(options, ",")
@@ -63,20 +61,65 @@ func ParseSelector(category string, options string) *Selector {
 	log.Infof("Parsed Selector: %#v", parseGroups)
 
 	for _, group := range parseGroups {
-		switch group[optType] {
-		case optTypeExists:
-			s.Exists[group[optCategory]] = true
-			break
-		case optTypeRequire:
-			s.Require[group[optCategory]] = group[optValue]
-			break
-		case optTypeExclude:
-			s.Exclude[group[optCategory]] = group[optValue]
-			break
+		s.addOption(group[optCategory], group[optType], group[optValue])
+	}
+
+	return s
+}
+
+// CompileSelector parses a single Selector written in instruction syntax, such as
+// "[Animal:type=mammal,env!=water]". Option values must be plain text, since there is no State or
+// Inventory to render nested tags with.
+func CompileSelector(src string) (*Selector, error) {
+	nodes, err := parse(src)
+	if err != nil {
+		return nil, err
+	}
+
+	var tag *selectorNode
+	if len(nodes) == 1 {
+		tag, _ = nodes[0].(*selectorNode)
+	}
+	if tag == nil {
+		return nil, newSyntaxError(src, 0, "expected a single selector tag")
+	}
+
+	s := newSelector(tag.category)
+	for _, opt := range tag.options {
+		value := ""
+		for _, v := range opt.value {
+			text, ok := v.(*textNode)
+			if !ok {
+				return nil, newSyntaxError(src, v.position(), "selector option values must be plain text")
+			}
+			value += text.text
 		}
+		s.addOption(opt.key, opt.op, value)
 	}
 
-	return &s
+	return s, nil
+}
+
+// newSelector creates a Selector for the category with no options.
+func newSelector(category string) *Selector {
+	return &Selector{
+		Category: category,
+		Require:  make(map[string]string),
+		Exclude:  make(map[string]string),
+		Exists:   make(map[string]bool),
+	}
+}
+
+// addOption adds a single option of the given type to the Selector.
+func (s *Selector) addOption(key string, optType string, value string) {
+	switch optType {
+	case optTypeExists:
+		s.Exists[key] = true
+	case optTypeRequire:
+		s.Require[key] = value
+	case optTypeExclude:
+		s.Exclude[key] = value
+	}
 }
 
 // IsSimple checks to see if the Selector only selects based upon its category.
@@ -119,3 +162,44 @@ func (s *Selector) MatchesToken(t *Token) bool {
 
 	return true
 }
+
+// String formats the Selector in instruction syntax. Options are sorted, so equivalent Selectors
+// always produce the same text.
+func (s *Selector) String() string {
+	var options []string
+	for k, v := range s.Require {
+		options = append(options, k+optTypeRequire+v)
+	}
+	for k, v := range s.Exclude {
+		options = append(options, k+optTypeExclude+v)
+	}
+	for k := range s.Exists {
+		options = append(options, k)
+	}
+
+	if len(options) == 0 {
+		return "[" + s.Category + "]"
+	}
+
+	sort.Strings(options)
+
+	return "[" + s.Category + ":" + strings.Join(options, ",") + "]"
+}
+
+// key builds an unambiguous identifier for the Selector, suitable for use as a cache key even when
+// option values contain punctuation.
+func (s *Selector) key() string {
+	var options []string
+	for k, v := range s.Require {
+		options = append(options, optTypeRequire+strconv.Quote(k)+strconv.Quote(v))
+	}
+	for k, v := range s.Exclude {
+		options = append(options, optTypeExclude+strconv.Quote(k)+strconv.Quote(v))
+	}
+	for k := range s.Exists {
+		options = append(options, "?"+strconv.Quote(k))
+	}
+	sort.Strings(options)
+
+	return strconv.Quote(s.Category) + strings.Join(options, "")
+}
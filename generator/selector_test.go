@@ -160,3 +160,36 @@ func (s *SelectorSuite) TestMatchesToken_MultiExists_MixedMismatch() {
 
 	s.False(x.MatchesToken(&t))
 }
+
+func (s *SelectorSuite) TestString() {
+	s.Equal("[animal]", ParseSelector("animal", "").String())
+	s.Equal("[animal:enabled,env!=water,type=mammal]", ParseSelector("animal", "type=mammal,env!=water,enabled").String())
+}
+
+func (s *SelectorSuite) TestKey() {
+	a := newSelector("animal")
+	a.addOption("a", optTypeRequire, "x,b=y")
+	b := newSelector("animal")
+	b.addOption("a", optTypeRequire, "x")
+	b.addOption("b", optTypeRequire, "y")
+
+	s.NotEqual(a.key(), b.key())
+	s.Equal(ParseSelector("animal", "b=y,a=x").key(), b.key())
+}
+
+func (s *SelectorSuite) TestCompileSelector() {
+	sel, err := CompileSelector("[Animal:type=mammal,env!=water,family]")
+
+	s.Require().NoError(err)
+	s.Equal("Animal", sel.Category)
+	s.Equal(map[string]string{"type": "mammal"}, sel.Require)
+	s.Equal(map[string]string{"env": "water"}, sel.Exclude)
+	s.Equal(map[string]bool{"family": true}, sel.Exists)
+}
+
+func (s *SelectorSuite) TestCompileSelector_Errors() {
+	for _, src := range []string{"", "Animal", "[Animal", "[Animal] [Plant]", "[$name]", "[Animal:type=[AnimalType]]"} {
+		_, err := CompileSelector(src)
+		s.Error(err, src)
+	}
+}
@@ -22,12 +22,22 @@ import "github.com/apex/log"
 // a Generator.
 type State struct {
 	Vars map[string]string
+	// Captures holds the Tokens picked by selectors with a capture name, such as [Animal#hero].
+	Captures map[string]Capture
+}
+
+// Capture records a Token picked by a selector with a capture name.
+type Capture struct {
+	Token Token
+	// Text is the rendered content of the Token.
+	Text string
 }
 
 // CreateState builds a new, empty State.
 func CreateState() *State {
 	return &State{
-		Vars: make(map[string]string),
+		Vars:     make(map[string]string),
+		Captures: make(map[string]Capture),
 	}
 }
 
@@ -38,3 +48,27 @@ func (s *State) SetVars(v map[string]string) {
 		log.Infof("Set variable: %s=%s", varName, val)
 	}
 }
+
+// capture binds a Token and its rendered content to the name, replacing any earlier capture.
+func (s *State) capture(name string, t *Token, text string) {
+	if s.Captures == nil {
+		s.Captures = make(map[string]Capture)
+	}
+
+	s.Captures[name] = Capture{Token: *t, Text: text}
+}
+
+// lookupCapture finds the text referenced by a capture name and optional property, reporting false if the
+// capture hasn't been made or its Token doesn't have the property.
+func lookupCapture(captures map[string]Capture, name string, property string) (string, bool) {
+	c, found := captures[name]
+	if !found {
+		return "", false
+	}
+	if property == "" {
+		return c.Text, true
+	}
+
+	val, found := c.Token.Properties[property]
+	return val, found
+}
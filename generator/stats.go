@@ -0,0 +1,142 @@
+/*
+ * Copyright 2020 zpxio (Jeff Sharpe)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package generator
+
+import (
+	"math"
+	"sort"
+)
+
+// TokenStats describes how likely a single Token is to be picked by a Selector.
+type TokenStats struct {
+	// Token is a copy, so changing it doesn't affect the Inventory.
+	Token Token
+	// Probability is the chance of the Token being picked, from its share of the matching Tokens'
+	// total Rarity.
+	Probability float64
+}
+
+// SelectorStats describes the distribution of Tokens picked by a Selector.
+type SelectorStats struct {
+	Selector *Selector
+	// Tokens lists every matching Token, from the most to the least likely. Tokens with the same
+	// probability keep their Inventory order.
+	Tokens []TokenStats
+	// Entropy is the Shannon entropy of a pick, in bits.
+	Entropy float64
+	// Effective is the number of equally likely Tokens which would give the same entropy.
+	Effective float64
+}
+
+// Stats describes the distribution of Tokens picked by the Selector. If no Token matches, the
+// statistics have no Tokens and zero Entropy.
+func (i *Inventory) Stats(s *Selector) *SelectorStats {
+	tokens, total := i.getTokens(s)
+
+	stats := &SelectorStats{Selector: s, Tokens: make([]TokenStats, 0, len(tokens))}
+	for idx := range tokens {
+		t := tokens[idx]
+		t.Properties = copyMap(t.Properties)
+		t.SetVars = copyMap(t.SetVars)
+		stats.Tokens = append(stats.Tokens, TokenStats{Token: t, Probability: t.Rarity / total})
+	}
+	sort.SliceStable(stats.Tokens, func(a, b int) bool {
+		return stats.Tokens[a].Probability > stats.Tokens[b].Probability
+	})
+
+	if len(tokens) > 0 {
+		stats.Entropy = distributionEntropy(tokens, total)
+	}
+	stats.Effective = math.Exp2(stats.Entropy)
+
+	return stats
+}
+
+// OutputStats describes how likely a Template is to render a particular text.
+type OutputStats struct {
+	Text        string
+	Probability float64
+}
+
+// TemplateStats describes the distribution of a Template's rendered output. Unlike an Entropy
+// estimate, different Token choices which render the same text are counted as a single output.
+type TemplateStats struct {
+	// Outputs is the number of distinct texts the Template can render.
+	Outputs int
+	// Entropy measures the unpredictability of the rendered text.
+	Entropy Entropy
+	// Effective is the number of equally likely outputs which would give the same Shannon entropy.
+	Effective float64
+	// MostLikely and LeastLikely list the outputs at each end of the distribution, starting with the
+	// most and least likely respectively. Outputs with the same probability are ordered by text.
+	MostLikely  []OutputStats
+	LeastLikely []OutputStats
+}
+
+// AnalyzeTemplate calculates the distribution of output from rendering the Template with the
+// Inventory, starting from the given State. Up to top outputs are listed at each end of the
+// distribution. Selectors which don't match any Token are handled according to the MissingPolicy,
+// and an error is returned if any possible render would fail, or if there are more than
+// ExploreLimit ways to render the Template.
+func AnalyzeTemplate(t *Template, i *Inventory, state *State, policy MissingPolicy, top int) (*TemplateStats, error) {
+	x := newExplorer(i, policy, false)
+
+	probs := make(map[string]float64)
+	err := x.explore(t, state, func(o outcome) error {
+		probs[o.text] += o.prob
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	outputs := make([]OutputStats, 0, len(probs))
+	for text, p := range probs {
+		outputs = append(outputs, OutputStats{Text: text, Probability: p})
+	}
+	sort.Slice(outputs, func(a, b int) bool {
+		if outputs[a].Probability != outputs[b].Probability {
+			return outputs[a].Probability > outputs[b].Probability
+		}
+		return outputs[a].Text < outputs[b].Text
+	})
+
+	stats := &TemplateStats{Outputs: len(outputs)}
+	for _, o := range outputs {
+		stats.Entropy.Shannon -= o.Probability * math.Log2(o.Probability)
+	}
+	stats.Entropy.Shannon = math.Max(stats.Entropy.Shannon, 0)
+	stats.Entropy.Min = math.Max(-math.Log2(outputs[0].Probability), 0)
+	stats.Effective = math.Exp2(stats.Entropy.Shannon)
+
+	if top > len(outputs) {
+		top = len(outputs)
+	}
+	if top > 0 {
+		stats.MostLikely = append([]OutputStats(nil), outputs[:top]...)
+
+		sort.Slice(outputs, func(a, b int) bool {
+			if outputs[a].Probability != outputs[b].Probability {
+				return outputs[a].Probability < outputs[b].Probability
+			}
+			return outputs[a].Text < outputs[b].Text
+		})
+		stats.LeastLikely = append([]OutputStats(nil), outputs[:top]...)
+	}
+
+	return stats, nil
+}
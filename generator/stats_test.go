@@ -0,0 +1,139 @@
+/*
+ * Copyright 2020 zpxio (Jeff Sharpe)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package generator
+
+import (
+	"github.com/stretchr/testify/suite"
+	"math"
+	"testing"
+)
+
+type StatsSuite struct {
+	suite.Suite
+}
+
+func TestStatsSuite(t *testing.T) {
+	suite.Run(t, new(StatsSuite))
+}
+
+func (s *StatsSuite) TestStats_Category() {
+	i := BuildSampleInventory()
+
+	stats := i.Stats(newSelector("Animal"))
+
+	// Rarities 1, 2, 1 and 2.5 out of 6.5
+	s.Require().Len(stats.Tokens, 4)
+	s.Equal("Cladoselache", stats.Tokens[0].Token.Content)
+	s.InDelta(2.5/6.5, stats.Tokens[0].Probability, 1e-9)
+	s.Equal("Boomalope", stats.Tokens[1].Token.Content)
+	s.Equal("Aardvark", stats.Tokens[2].Token.Content)
+	s.Equal("Capybara", stats.Tokens[3].Token.Content)
+	s.InDelta(1/6.5, stats.Tokens[3].Probability, 1e-9)
+
+	expected := 0.0
+	for _, r := range []float64{1, 2, 1, 2.5} {
+		expected -= r / 6.5 * math.Log2(r/6.5)
+	}
+	s.InDelta(expected, stats.Entropy, 1e-9)
+	s.InDelta(math.Exp2(expected), stats.Effective, 1e-9)
+}
+
+func (s *StatsSuite) TestStats_Selector() {
+	i := BuildSampleInventory()
+
+	stats := i.Stats(ParseSelector("Animal", "type=mammal"))
+
+	s.Require().Len(stats.Tokens, 2)
+	s.InDelta(0.5, stats.Tokens[0].Probability, 1e-9)
+	s.InDelta(1.0, stats.Entropy, 1e-9)
+	s.InDelta(2.0, stats.Effective, 1e-9)
+
+	stats.Tokens[0].Token.Properties["type"] = "changed"
+	again := i.Stats(ParseSelector("Animal", "type=mammal"))
+	s.Equal("mammal", again.Tokens[0].Token.Properties["type"])
+}
+
+func (s *StatsSuite) TestStats_NoMatch() {
+	i := BuildSampleInventory()
+
+	stats := i.Stats(newSelector("Plant"))
+
+	s.Empty(stats.Tokens)
+	s.Equal(0.0, stats.Entropy)
+	s.Equal(1.0, stats.Effective)
+}
+
+func (s *StatsSuite) TestAnalyzeTemplate() {
+	i := CreateInventory()
+	i.AddToken("Colour", "red", 3.0, Properties{})
+	i.AddToken("Colour", "blue", 1.0, Properties{})
+	i.AddToken("Shape", "box", 1.0, Properties{})
+	i.AddToken("Shape", "ball", 1.0, Properties{})
+
+	stats, err := AnalyzeTemplate(MustCompile("[Colour] [Shape]"), i, nil, FailOnMissing, 2)
+
+	s.Require().NoError(err)
+	s.Equal(4, stats.Outputs)
+	s.Equal([]OutputStats{{Text: "red ball", Probability: 0.375}, {Text: "red box", Probability: 0.375}}, stats.MostLikely)
+	s.Equal([]OutputStats{{Text: "blue ball", Probability: 0.125}, {Text: "blue box", Probability: 0.125}}, stats.LeastLikely)
+	s.InDelta(-0.75*math.Log2(0.375)-0.25*math.Log2(0.125), stats.Entropy.Shannon, 1e-9)
+	s.InDelta(-math.Log2(0.375), stats.Entropy.Min, 1e-9)
+	s.InDelta(math.Exp2(stats.Entropy.Shannon), stats.Effective, 1e-9)
+}
+
+func (s *StatsSuite) TestAnalyzeTemplate_DuplicateOutputs() {
+	i := CreateInventory()
+	i.AddToken("Word", "same", 1.0, Properties{})
+	i.AddToken("Word", "same", 1.0, Properties{})
+	i.AddToken("Word", "other", 2.0, Properties{})
+
+	stats, err := AnalyzeTemplate(MustCompile("[Word]"), i, nil, FailOnMissing, 5)
+
+	s.Require().NoError(err)
+	s.Equal(2, stats.Outputs)
+	s.Len(stats.MostLikely, 2)
+	s.InDelta(1.0, stats.Entropy.Shannon, 1e-9)
+	s.InDelta(1.0, stats.Entropy.Min, 1e-9)
+}
+
+func (s *StatsSuite) TestAnalyzeTemplate_Static() {
+	stats, err := AnalyzeTemplate(MustCompile("Nothing random"), CreateInventory(), nil, FailOnMissing, 3)
+
+	s.Require().NoError(err)
+	s.Equal(1, stats.Outputs)
+	s.Equal(0.0, stats.Entropy.Shannon)
+	s.Equal(1.0, stats.Effective)
+	s.Equal([]OutputStats{{Text: "Nothing random", Probability: 1.0}}, stats.MostLikely)
+}
+
+func (s *StatsSuite) TestAnalyzeTemplate_Missing() {
+	_, err := AnalyzeTemplate(MustCompile("[Plant]"), BuildSampleInventory(), nil, FailOnMissing, 3)
+
+	s.Error(err)
+}
+
+func (s *StatsSuite) TestGenerator_Stats() {
+	g, err := CompileGenerator("[Animal:type=mammal]", BuildSampleInventory())
+	s.Require().NoError(err)
+
+	stats, err := g.Stats(nil, 1)
+
+	s.Require().NoError(err)
+	s.Equal(2, stats.Outputs)
+	s.Equal([]OutputStats{{Text: "Aardvark", Probability: 0.5}}, stats.MostLikely)
+	s.Equal([]OutputStats{{Text: "Aardvark", Probability: 0.5}}, stats.LeastLikely)
+}
@@ -0,0 +1,76 @@
+/*
+ * Copyright 2020 zpxio (Jeff Sharpe)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package generator
+
+import (
+	"github.com/zpxio/octogen/rng"
+	"strings"
+)
+
+// Template is a compiled instruction. Compiling validates the instruction syntax once, so that a
+// Template can be rendered many times without parsing it again.
+type Template struct {
+	source string
+	nodes  []node
+}
+
+// Compile parses an instruction into a Template. If the instruction isn't valid, a *SyntaxError is
+// returned describing the first problem found.
+func Compile(instructions string) (*Template, error) {
+	nodes, err := parse(instructions)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Template{source: instructions, nodes: nodes}, nil
+}
+
+// MustCompile parses an instruction into a Template, panicking if the instruction isn't valid. It
+// is intended for instructions which are fixed at build time.
+func MustCompile(instructions string) *Template {
+	t, err := Compile(instructions)
+	if err != nil {
+		panic("generator: Compile(" + instructions + "): " + err.Error())
+	}
+
+	return t
+}
+
+// String returns the instruction text the Template was compiled from.
+func (t *Template) String() string {
+	return t.source
+}
+
+// Render generates output from the Template using the Inventory, State and RandomSource. Selectors
+// which don't match any Token are handled according to the MissingPolicy.
+func (t *Template) Render(i *Inventory, state *State, source rng.RandomSource, policy MissingPolicy) (string, error) {
+	text, _, err := t.execute(i, state, source, policy)
+
+	return text, err
+}
+
+// execute renders the Template, also returning the IDs of the Tokens picked.
+func (t *Template) execute(i *Inventory, state *State, source rng.RandomSource, policy MissingPolicy) (string, []string, error) {
+	r := &renderer{inventory: i, state: state, source: source, missing: policy}
+
+	var out strings.Builder
+	if err := r.render(t.nodes, &out, 0); err != nil {
+		return "", r.picked, err
+	}
+
+	return out.String(), r.picked, nil
+}
@@ -0,0 +1,83 @@
+/*
+ * Copyright 2020 zpxio (Jeff Sharpe)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package generator
+
+import (
+	"github.com/stretchr/testify/suite"
+	"github.com/zpxio/octogen/rng"
+	"testing"
+)
+
+type TemplateSuite struct {
+	suite.Suite
+}
+
+func TestTemplateSuite(t *testing.T) {
+	suite.Run(t, new(TemplateSuite))
+}
+
+func (s *TemplateSuite) TestCompile() {
+	t, err := Compile("Example: [Description] [Animal:type=[$type]]")
+
+	s.NoError(err)
+	s.Require().NotNil(t)
+	s.Equal("Example: [Description] [Animal:type=[$type]]", t.String())
+	s.Len(t.nodes, 4)
+}
+
+func (s *TemplateSuite) TestCompile_Invalid() {
+	t, err := Compile("Example: [Animal:type=mammal")
+
+	s.Nil(t)
+	s.IsType(&SyntaxError{}, err)
+}
+
+func (s *TemplateSuite) TestMustCompile() {
+	s.NotPanics(func() { MustCompile("[Animal]") })
+	s.Panics(func() { MustCompile("[Animal") })
+}
+
+func (s *TemplateSuite) TestRender_Repeated() {
+	i := BuildSampleInventory()
+	t := MustCompile("Example: [Animal:type=[$type]]")
+
+	x := CreateState()
+	x.Vars["type"] = "mammal"
+
+	r := rng.UseManual(0, 1)
+
+	result1, err := t.Render(i, x, r, FailOnMissing)
+	s.NoError(err)
+	s.Equal("Example: Aardvark", result1)
+
+	result2, err := t.Render(i, x, r, FailOnMissing)
+	s.NoError(err)
+	s.Equal("Example: Capybara", result2)
+}
+
+func (s *TemplateSuite) TestRender_CompiledContent() {
+	i := BuildSampleInventory()
+	c := i.AddToken("Creature", "[Description] [Animal]", 1.0, Properties{})
+
+	s.NotNil(c.compiled)
+	s.Nil(i.dictionary["Animal"][0].compiled)
+
+	result, err := MustCompile("A [Creature]").Render(i, CreateState(), rng.UseStatic(0), FailOnMissing)
+
+	s.NoError(err)
+	s.Equal("A Angry Aardvark", result)
+}
@@ -18,13 +18,18 @@ package generator
 
 import "strings"
 
-// Token represents a single item which can be placed into the generated output of a Generator.
+// Token represents a single item which can be placed into the generated output of a Generator. A Token
+// may have an ID, which must be unique within its Inventory, so that it can be found again later.
 type Token struct {
-	Category   string
-	Content    string
-	Rarity     float64
-	Properties map[string]string
-	SetVars    map[string]string
+	ID         string            `yaml:"id,omitempty" json:"id,omitempty" toml:"id,omitempty"`
+	Category   string            `yaml:"category" json:"category" toml:"category"`
+	Content    string            `yaml:"content" json:"content" toml:"content"`
+	Rarity     float64           `yaml:"rarity" json:"rarity" toml:"rarity"`
+	Properties map[string]string `yaml:"properties,omitempty" json:"properties,omitempty" toml:"properties,omitempty"`
+	SetVars    map[string]string `yaml:"setvars,omitempty" json:"setvars,omitempty" toml:"setvars,omitempty"`
+
+	// compiled holds the compiled Content when it contains tags
+	compiled *Template
 }
 
 // Properties defines the structure used to store token properties.
@@ -49,10 +54,11 @@ func (t *Token) OnRenderSet(variable string, value string) {
 	t.SetVars[variable] = value
 }
 
-// Normalize updates the Token to ensure that it matches required behaviors. Categories must not start
-// or end with whitespace. Rarities must not be zero or negative. If the Rarity is invalid, it is set
-// to a default of 1.0
+// Normalize updates the Token to ensure that it matches required behaviors. IDs and Categories must not
+// start or end with whitespace. Rarities must not be zero or negative. If the Rarity is invalid, it is
+// set to a default of 1.0
 func (t *Token) Normalize() {
+	t.ID = strings.TrimSpace(t.ID)
 	t.Category = strings.TrimSpace(t.Category)
 	if t.Rarity <= 0.0 {
 		t.Rarity = 1.0
@@ -77,3 +83,12 @@ func (t *Token) IsValid() bool {
 
 	return true
 }
+
+// compile prepares the Content of the Token for rendering. Content without tags is rendered as-is and
+// isn't compiled. Content which can't be compiled is left to fail when it is rendered.
+func (t *Token) compile() {
+	t.compiled = nil
+	if hasTags(t.Content) {
+		t.compiled, _ = Compile(t.Content)
+	}
+}
@@ -1,10 +1,17 @@
 module github.com/zpxio/octogen
 
-go 1.13
+go 1.17
 
 require (
+	github.com/BurntSushi/toml v1.3.2
 	github.com/apex/log v1.3.0
-	github.com/pkg/errors v0.8.1
+	github.com/pkg/errors v0.9.1
 	github.com/stretchr/testify v1.4.0
-	gopkg.in/yaml.v2 v2.2.2
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require (
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	gopkg.in/yaml.v2 v2.2.2 // indirect
 )
@@ -16,10 +16,13 @@
 
 package rng
 
+import "sync"
+
 // ManualRand defines a RandomSource which is manually fed random values to be
 // retrieved. This is very useful for taking complete control of random number generation
 // for unit testing.
 type ManualRand struct {
+	mu     sync.Mutex
 	values []float64
 }
 
@@ -37,6 +40,9 @@ func UseManual(v ...float64) *ManualRand {
 // Next retrieves the next value in the queue of random numbers. If no values have been stored in
 // buffer, then the function panics.
 func (r *ManualRand) Next() float64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
 	if len(r.values) < 1 {
 		panic("attempt to read from empty random source")
 	}
@@ -49,10 +55,16 @@ func (r *ManualRand) Next() float64 {
 
 // Clear removes all stored values in the random queue.
 func (r *ManualRand) Clear() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
 	r.values = []float64{}
 }
 
 // Add adds new values to the queue of values to supply via the Next function.
 func (r *ManualRand) Add(v ...float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
 	r.values = append(r.values, v...)
 }
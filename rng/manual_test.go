@@ -18,6 +18,7 @@ package rng
 
 import (
 	"github.com/stretchr/testify/suite"
+	"sync"
 	"testing"
 )
 
@@ -72,3 +73,22 @@ func (s *RngSuite) TestUsage() {
 	s.Equal(5.0, r.Next())
 	s.Equal(6.0, r.Next())
 }
+
+func (s *RngSuite) TestManualConcurrent() {
+	r := UseManual()
+
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for n := 0; n < 100; n++ {
+				r.Add(0.5)
+				r.Next()
+			}
+		}()
+	}
+	wg.Wait()
+
+	s.Empty(r.values)
+}
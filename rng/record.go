@@ -0,0 +1,186 @@
+/*
+ * Copyright 2020 zpxio (Jeff Sharpe)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package rng
+
+import (
+	"encoding/binary"
+	"github.com/pkg/errors"
+	"math"
+	"sync"
+)
+
+// recordingMagic identifies the compact binary form of a Recording.
+const recordingMagic = "OGR1"
+
+// ErrReplayExhausted is reported by a ReplayRand when more values are requested than were recorded.
+var ErrReplayExhausted = errors.New("replayed recording has no more values")
+
+// Recording is a log of the values drawn from a RandomSource. It can be serialized as JSON or in a
+// compact binary form, and replayed with a ReplayRand to reproduce the same sequence of values.
+type Recording struct {
+	Values []float64 `json:"values"`
+}
+
+// MarshalBinary encodes the Recording as a magic header, a value count, and the IEEE 754 bits of
+// each value.
+func (r *Recording) MarshalBinary() ([]byte, error) {
+	data := make([]byte, 0, len(recordingMagic)+binary.MaxVarintLen64+8*len(r.Values))
+	data = append(data, recordingMagic...)
+
+	var buf [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(buf[:], uint64(len(r.Values)))
+	data = append(data, buf[:n]...)
+
+	for _, v := range r.Values {
+		binary.LittleEndian.PutUint64(buf[:8], math.Float64bits(v))
+		data = append(data, buf[:8]...)
+	}
+
+	return data, nil
+}
+
+// UnmarshalBinary decodes a Recording created by MarshalBinary.
+func (r *Recording) UnmarshalBinary(data []byte) error {
+	if len(data) < len(recordingMagic) || string(data[:len(recordingMagic)]) != recordingMagic {
+		return errors.New("not a binary recording")
+	}
+	data = data[len(recordingMagic):]
+
+	count, n := binary.Uvarint(data)
+	if n <= 0 {
+		return errors.New("invalid recording length")
+	}
+	data = data[n:]
+
+	if uint64(len(data)) != count*8 {
+		return errors.Errorf("recording should contain %d values, found %d bytes", count, len(data))
+	}
+
+	r.Values = make([]float64, count)
+	for idx := range r.Values {
+		r.Values[idx] = math.Float64frombits(binary.LittleEndian.Uint64(data[idx*8:]))
+	}
+
+	return nil
+}
+
+// RecordingRand is a RandomSource which records every value drawn from another RandomSource.
+type RecordingRand struct {
+	mu     sync.Mutex
+	source RandomSource
+	values []float64
+}
+
+// UseRecorder creates a new RecordingRand which draws values from the given source.
+func UseRecorder(source RandomSource) *RecordingRand {
+	return &RecordingRand{
+		source: source,
+		values: []float64{},
+	}
+}
+
+// Next draws the next value from the underlying source and records it.
+func (r *RecordingRand) Next() float64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	v := r.source.Next()
+	r.values = append(r.values, v)
+
+	return v
+}
+
+// Recording returns a copy of the values recorded so far.
+func (r *RecordingRand) Recording() *Recording {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	values := make([]float64, len(r.values))
+	copy(values, r.values)
+
+	return &Recording{Values: values}
+}
+
+// Reset discards the values recorded so far.
+func (r *RecordingRand) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.values = []float64{}
+}
+
+// IsSecure reports whether the underlying source is cryptographically secure.
+func (r *RecordingRand) IsSecure() bool {
+	return IsSecure(r.source)
+}
+
+// Err returns any failure recorded by the underlying source.
+func (r *RecordingRand) Err() error {
+	return Err(r.source)
+}
+
+// ReplayRand is a RandomSource which supplies the values of a Recording in order. Unlike ManualRand, it
+// doesn't panic when it runs out of values. Instead, it returns zero and reports ErrReplayExhausted
+// from Err.
+type ReplayRand struct {
+	mu     sync.Mutex
+	values []float64
+	err    error
+}
+
+// UseReplay creates a new ReplayRand which supplies the values in the Recording.
+func UseReplay(rec *Recording) *ReplayRand {
+	r := &ReplayRand{
+		values: make([]float64, len(rec.Values)),
+	}
+	copy(r.values, rec.Values)
+
+	return r
+}
+
+// Next retrieves the next recorded value. If all values have been used, zero is returned and the
+// ReplayRand records ErrReplayExhausted.
+func (r *ReplayRand) Next() float64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(r.values) < 1 {
+		r.err = ErrReplayExhausted
+		return 0
+	}
+
+	next := r.values[0]
+	r.values = r.values[1:]
+
+	return next
+}
+
+// Remaining returns the number of recorded values which haven't been used yet.
+func (r *ReplayRand) Remaining() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return len(r.values)
+}
+
+// Err returns ErrReplayExhausted if more values were requested than were recorded.
+func (r *ReplayRand) Err() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.err
+}
@@ -0,0 +1,110 @@
+/*
+ * Copyright 2020 zpxio (Jeff Sharpe)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package rng
+
+import "encoding/json"
+
+func (s *RngSuite) TestRecorder() {
+	r := UseRecorder(UseSeeded(5))
+
+	a := r.Next()
+	b := r.Next()
+
+	s.Equal([]float64{a, b}, r.Recording().Values)
+
+	r.Reset()
+	c := r.Next()
+	s.Equal([]float64{c}, r.Recording().Values)
+}
+
+func (s *RngSuite) TestRecorder_Secure() {
+	s.False(IsSecure(UseRecorder(UseSeeded(5))))
+	s.True(IsSecure(UseRecorder(UseSecure())))
+}
+
+func (s *RngSuite) TestRecorder_Err() {
+	r := UseRecorder(UseReplay(&Recording{Values: []float64{0.5}}))
+
+	s.Equal(0.5, r.Next())
+	s.NoError(Err(r))
+
+	r.Next()
+	s.Equal(ErrReplayExhausted, Err(r))
+}
+
+func (s *RngSuite) TestReplay() {
+	r := UseReplay(&Recording{Values: []float64{0.25, 0.5}})
+
+	s.Equal(2, r.Remaining())
+	s.Equal(0.25, r.Next())
+	s.Equal(0.5, r.Next())
+	s.NoError(r.Err())
+	s.NoError(Err(r))
+
+	s.NotPanics(func() {
+		s.Equal(0.0, r.Next())
+	})
+	s.Equal(ErrReplayExhausted, r.Err())
+	s.Equal(ErrReplayExhausted, Err(r))
+	s.NoError(Err(UseStatic(0)))
+}
+
+func (s *RngSuite) TestRecordReplay() {
+	rec := UseRecorder(UseSecure())
+	var original []float64
+	for i := 0; i < 100; i++ {
+		original = append(original, rec.Next())
+	}
+
+	replay := UseReplay(rec.Recording())
+	for _, v := range original {
+		s.Equal(v, replay.Next())
+	}
+	s.NoError(replay.Err())
+}
+
+func (s *RngSuite) TestRecording_JSON() {
+	rec := UseRecorder(UseSeeded(11))
+	for i := 0; i < 10; i++ {
+		rec.Next()
+	}
+
+	data, err := json.Marshal(rec.Recording())
+	s.Require().NoError(err)
+
+	var decoded Recording
+	s.Require().NoError(json.Unmarshal(data, &decoded))
+	s.Equal(rec.Recording(), &decoded)
+}
+
+func (s *RngSuite) TestRecording_Binary() {
+	rec := UseRecorder(UseSeeded(11))
+	for i := 0; i < 10; i++ {
+		rec.Next()
+	}
+
+	data, err := rec.Recording().MarshalBinary()
+	s.Require().NoError(err)
+	s.Len(data, 4+1+80)
+
+	var decoded Recording
+	s.Require().NoError(decoded.UnmarshalBinary(data))
+	s.Equal(rec.Recording(), &decoded)
+
+	s.Error(decoded.UnmarshalBinary([]byte("nope")))
+	s.Error(decoded.UnmarshalBinary(data[:20]))
+}
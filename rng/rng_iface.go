@@ -18,6 +18,8 @@
 // are packaged into structs to allow them to be passed as function parameters. This provides better
 // support for testing as alternate implementations can be passed which produce "random" behavior which
 // is predictable enough for complex unit testing.
+//
+// Every RandomSource in this package is safe for concurrent use.
 package rng
 
 // RandomSource defines an interface which can be used to supply data to code performing
@@ -26,3 +28,37 @@ type RandomSource interface {
 	// Next retrieves a psudo-random floatin-point number, such that 0 <= n < 1
 	Next() float64
 }
+
+// SecureSource is implemented by RandomSources which can report whether they are cryptographically
+// secure.
+type SecureSource interface {
+	RandomSource
+
+	// IsSecure reports if the values produced are unpredictable enough to be used for secrets.
+	IsSecure() bool
+}
+
+// IsSecure checks if the RandomSource is cryptographically secure.
+func IsSecure(r RandomSource) bool {
+	s, ok := r.(SecureSource)
+
+	return ok && s.IsSecure()
+}
+
+// FallibleSource is implemented by RandomSources which can fail to supply values. Because Next can't
+// return an error, such sources record the failure and report it from Err.
+type FallibleSource interface {
+	RandomSource
+
+	// Err returns the first failure encountered while supplying values, if any.
+	Err() error
+}
+
+// Err returns the failure recorded by a FallibleSource, or nil for any other RandomSource.
+func Err(r RandomSource) error {
+	if f, ok := r.(FallibleSource); ok {
+		return f.Err()
+	}
+
+	return nil
+}
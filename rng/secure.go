@@ -0,0 +1,49 @@
+/*
+ * Copyright 2020 zpxio (Jeff Sharpe)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package rng
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+)
+
+// SecureRand is a RandomSource backed by the operating system's cryptographically secure random
+// number generator. Its output can't be predicted from previous values, making it suitable for
+// generating passphrases and other secrets.
+type SecureRand struct {
+}
+
+// UseSecure creates a new SecureRand.
+func UseSecure() *SecureRand {
+	return &SecureRand{}
+}
+
+// Next returns a uniformly distributed value in [0, 1) built from 53 secure random bits. If the
+// operating system can't supply random data, the function panics rather than returning weak values.
+func (s *SecureRand) Next() float64 {
+	var b [8]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic("failed to read from secure random source: " + err.Error())
+	}
+
+	return float64(binary.LittleEndian.Uint64(b[:])>>11) / (1 << 53)
+}
+
+// IsSecure reports that SecureRand is cryptographically secure.
+func (s *SecureRand) IsSecure() bool {
+	return true
+}
@@ -0,0 +1,44 @@
+/*
+ * Copyright 2020 zpxio (Jeff Sharpe)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package rng
+
+func (s *RngSuite) TestSecureInit() {
+	r := UseSecure()
+
+	s.NotNil(r)
+	s.True(IsSecure(r))
+}
+
+func (s *RngSuite) TestSecureUsage() {
+	r := UseSecure()
+
+	sum := 0.0
+	for i := 0; i < 10000; i++ {
+		x := r.Next()
+		s.True(x >= 0 && x < 1)
+		sum += x
+	}
+
+	s.InDelta(0.5, sum/10000, 0.05)
+}
+
+func (s *RngSuite) TestIsSecure() {
+	s.False(IsSecure(UseSystem()))
+	s.False(IsSecure(UseStatic(0.5)))
+	s.False(IsSecure(UseSeeded(1)))
+	s.True(IsSecure(UseSecure()))
+}
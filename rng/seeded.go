@@ -0,0 +1,83 @@
+/*
+ * Copyright 2020 zpxio (Jeff Sharpe)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package rng
+
+import (
+	"math/bits"
+	"sync"
+)
+
+// SeededRand is a RandomSource which produces a repeatable sequence of values from a seed. It
+// implements the xoshiro256** generator, seeded using splitmix64, entirely with integer arithmetic,
+// so the same seed produces exactly the same sequence on every platform and Go version.
+type SeededRand struct {
+	mu    sync.Mutex
+	seed  uint64
+	state [4]uint64
+}
+
+// UseSeeded creates a new SeededRand which produces the sequence of values for the given seed.
+func UseSeeded(seed uint64) *SeededRand {
+	r := &SeededRand{seed: seed}
+
+	x := seed
+	for n := range r.state {
+		x += 0x9e3779b97f4a7c15
+		z := x
+		z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+		z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+		r.state[n] = z ^ (z >> 31)
+	}
+
+	return r
+}
+
+// Seed returns the seed the SeededRand was created with.
+func (r *SeededRand) Seed() uint64 {
+	return r.seed
+}
+
+// Uint64 returns the next 64 pseudo-random bits in the sequence.
+func (r *SeededRand) Uint64() uint64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s := &r.state
+	result := bits.RotateLeft64(s[1]*5, 7) * 9
+	t := s[1] << 17
+
+	s[2] ^= s[0]
+	s[3] ^= s[1]
+	s[1] ^= s[2]
+	s[0] ^= s[3]
+	s[2] ^= t
+	s[3] = bits.RotateLeft64(s[3], 45)
+
+	return result
+}
+
+// Next returns the next value in the sequence, using the upper 53 bits of the generator output so
+// that every value is exactly representable and uniformly distributed in [0, 1).
+func (r *SeededRand) Next() float64 {
+	return float64(r.Uint64()>>11) / (1 << 53)
+}
+
+// Split creates a new SeededRand whose seed is drawn from this one. Splitting a seeded source gives
+// each goroutine its own repeatable stream, without the streams having to share a lock.
+func (r *SeededRand) Split() *SeededRand {
+	return UseSeeded(r.Uint64())
+}